@@ -0,0 +1,345 @@
+package main
+
+/**
+ * files of a larix log, by larix rotate naming:
+ *	File, File.wf                                not rotated, newest lines
+ *	File.SUFFIX[.gz], File.wf.SUFFIX[.gz]        rotated
+ * SUFFIX is YYYYMMDDHH, YYYYMMDD or YYYYMMDDHHMMSS[.N] by rotate policy,
+ * it is the time when file starts
+ *
+ * files moved by external logrotate are read too:
+ *	File.N[.gz], File.wf.N[.gz]                  bigger N is older
+ *	File-DATE[.gz], File.wf-DATE[.gz]            dateext, DATE like SUFFIX
+ * they go before File, numbered ones after dated ones; other files like
+ * File.SOMETHING are skipped with a warning
+ **/
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//suffix layouts by length
+var suffixLayouts = map[int]string{
+	8:  "20060102",
+	10: "2006010215",
+	14: "20060102150405",
+}
+
+//file kinds in time order
+const (
+	fileDated = iota
+	fileNumbered
+	fileCurrent
+)
+
+type logFile struct {
+	path string
+	kind int
+
+	//time when file starts, zero for numbered and current file
+	start time.Time
+
+	//N of size rotate in the same second
+	seq int
+
+	//N of logrotate numbered file
+	num int
+}
+
+func (f logFile) before(other logFile) bool {
+	if f.kind != other.kind {
+		return f.kind < other.kind
+	}
+	if !f.start.Equal(other.start) {
+		return f.start.Before(other.start)
+	}
+	if f.num != other.num {
+		return f.num > other.num
+	}
+	return f.seq < other.seq
+}
+
+//listLogFiles normal or wf files of base in time order, and files skipped
+func listLogFiles(base string, wf bool) ([]logFile, []string) {
+	current := base
+	if wf {
+		current = base + ".wf"
+	}
+
+	res := []logFile{}
+	//a symlink points to a rotated file, which is listed by itself
+	if info, err := os.Lstat(current); err == nil && info.Mode().IsRegular() {
+		res = append(res, logFile{path: current, kind: fileCurrent})
+	}
+
+	skipped := []string{}
+	for _, sep := range []string{".", "-"} {
+		prefix := current + sep
+		matches, _ := filepath.Glob(prefix + "*")
+		for _, path := range matches {
+			suffix := strings.TrimPrefix(path, prefix)
+			//wf files of base, and temp symlink of larix rotate
+			if !wf && (strings.HasPrefix(suffix, "wf.") || strings.HasPrefix(suffix, "wf-") || suffix == "wf") || suffix == "tmp" {
+				continue
+			}
+
+			file, ok := parseLogSuffix(strings.TrimSuffix(suffix, ".gz"), sep == "-")
+			if !ok {
+				skipped = append(skipped, path)
+				continue
+			}
+			file.path = path
+			res = append(res, file)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].before(res[j]) })
+	return res, skipped
+}
+
+//parseLogSuffix larix suffix or logrotate N, dateext takes date only
+func parseLogSuffix(suffix string, dateext bool) (logFile, bool) {
+	//logrotate numbered, shorter than any date
+	if num, err := strconv.Atoi(suffix); err == nil && !dateext && len(suffix) < 8 && num > 0 {
+		return logFile{kind: fileNumbered, num: num}, true
+	}
+
+	seq := 0
+	if idx := strings.Index(suffix, "."); idx >= 0 && !dateext {
+		var err error
+		if seq, err = strconv.Atoi(suffix[idx+1:]); err != nil {
+			return logFile{}, false
+		}
+		suffix = suffix[:idx]
+	}
+	layout, exists := suffixLayouts[len(suffix)]
+	if !exists {
+		return logFile{}, false
+	}
+	start, err := time.ParseInLocation(layout, suffix, time.Local)
+	if err != nil {
+		return logFile{}, false
+	}
+	return logFile{kind: fileDated, start: start, seq: seq}, true
+}
+
+//pruneLogFiles drop files out of time range, a file ends when next one starts,
+//files without start time are kept
+func pruneLogFiles(files []logFile, opts *options) []logFile {
+	res := []logFile{}
+	for i, file := range files {
+		if !opts.since.IsZero() && i+1 < len(files) && !files[i+1].start.IsZero() && !files[i+1].start.After(opts.since) {
+			continue
+		}
+		if !opts.until.IsZero() && !file.start.IsZero() && !file.start.Before(opts.until) {
+			continue
+		}
+		res = append(res, file)
+	}
+	return res
+}
+
+//lineReader read records of files one by one, the last file may grow when follow
+type lineReader struct {
+	base string
+	wf   bool
+
+	files []logFile
+	idx   int
+
+	fd      *os.File
+	reader  *bufio.Reader
+	partial string
+
+	//time and level of lines not parsed, like the previous line
+	last record
+}
+
+func newLineReader(base string, wf bool, opts *options, warn io.Writer) *lineReader {
+	files, skipped := listLogFiles(base, wf)
+	for _, path := range skipped {
+		fmt.Fprintf(warn, "larixlog: skip %s, unknown rotate suffix\n", path)
+	}
+	return &lineReader{base: base, wf: wf, files: pruneLogFiles(files, opts)}
+}
+
+//next record, false when no more lines for now
+func (r *lineReader) next() (*record, bool) {
+	for r.idx < len(r.files) {
+		if r.reader == nil && !r.open() {
+			r.idx++
+			continue
+		}
+
+		data, err := r.reader.ReadString('\n')
+		if err == nil {
+			line := r.partial + strings.TrimSuffix(data, "\n")
+			r.partial = ""
+			return r.parse(line), true
+		}
+		r.partial += data
+
+		//last file may be written later
+		if r.idx == len(r.files)-1 {
+			return nil, false
+		}
+		if rec, ok := r.finish(); ok {
+			return rec, true
+		}
+	}
+	return nil, false
+}
+
+//flush line without "\n" at end of last file
+func (r *lineReader) flush() (*record, bool) {
+	return r.finish()
+}
+
+//refresh find files rotated after current ones
+func (r *lineReader) refresh() {
+	files, _ := listLogFiles(r.base, r.wf)
+	if len(r.files) == 0 {
+		r.files = files
+		return
+	}
+
+	last := r.files[len(r.files)-1]
+	for _, file := range files {
+		if last.before(file) {
+			r.files = append(r.files, file)
+		}
+	}
+}
+
+func (r *lineReader) close() {
+	if r.fd != nil {
+		r.fd.Close()
+		r.fd, r.reader = nil, nil
+	}
+}
+
+func (r *lineReader) open() bool {
+	fd, err := os.Open(r.files[r.idx].path)
+	if err != nil {
+		return false
+	}
+	var reader io.Reader = fd
+	if strings.HasSuffix(fd.Name(), ".gz") {
+		gz, err := gzip.NewReader(fd)
+		if err != nil {
+			fd.Close()
+			return false
+		}
+		reader = gz
+	}
+	r.fd, r.reader = fd, bufio.NewReader(reader)
+	return true
+}
+
+//finish current file, go to next one
+func (r *lineReader) finish() (*record, bool) {
+	r.close()
+	r.idx++
+
+	if r.partial == "" {
+		return nil, false
+	}
+	line := r.partial
+	r.partial = ""
+	return r.parse(line), true
+}
+
+func (r *lineReader) parse(line string) *record {
+	rec, ok := parseRecord(line)
+	if !ok {
+		//like stack lines, go with previous line
+		rec = &record{time: r.last.time, level: r.last.level, fields: r.last.fields, line: line}
+	}
+	r.last = *rec
+	return rec
+}
+
+//run print matched lines of bases merged by time, then follow if needed
+func run(ctx context.Context, opts *options, bases []string, out io.Writer, warn io.Writer) error {
+	readers := []*lineReader{}
+	for _, base := range bases {
+		readers = append(readers, newLineReader(base, false, opts, warn), newLineReader(base, true, opts, warn))
+	}
+	defer func() {
+		for _, reader := range readers {
+			reader.close()
+		}
+	}()
+
+	writer := bufio.NewWriter(out)
+	if err := printMerged(writer, readers, opts); err != nil {
+		return err
+	}
+	if !opts.follow {
+		for _, reader := range readers {
+			if rec, ok := reader.flush(); ok && rec.match(opts) {
+				io.WriteString(writer, rec.line+"\n")
+			}
+		}
+		return writer.Flush()
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for _, reader := range readers {
+			reader.refresh()
+		}
+		if err := printMerged(writer, readers, opts); err != nil {
+			return err
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+//printMerged print lines readers have for now, the earliest first
+func printMerged(out io.Writer, readers []*lineReader, opts *options) error {
+	heads := make([]*record, len(readers))
+	for i, reader := range readers {
+		heads[i], _ = reader.next()
+	}
+
+	for {
+		min := -1
+		for i, head := range heads {
+			if head != nil && (min < 0 || head.time.Before(heads[min].time)) {
+				min = i
+			}
+		}
+		if min < 0 {
+			return nil
+		}
+
+		if heads[min].match(opts) {
+			if _, err := io.WriteString(out, heads[min].line+"\n"); err != nil {
+				return err
+			}
+		}
+		heads[min], _ = readers[min].next()
+	}
+}
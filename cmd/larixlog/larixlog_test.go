@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kstrwind/lib-go/larix"
+)
+
+func writeLogFile(t *testing.T, file string, lines ...string) {
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	if strings.HasSuffix(file, ".gz") {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write(content)
+		writer.Close()
+		content = buf.Bytes()
+	}
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatalf("write log file %s failed: %s", file, err)
+	}
+}
+
+func jsonTime(value string) string {
+	t, _ := time.ParseInLocation("2006/01/02 15:04:05", value, time.Local)
+	return t.Format(jsonTimeLayout)
+}
+
+//logs of two hours, text and json, normal and wf, gzipped and symlinked
+func writeTestLogs(t *testing.T) string {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "app.log")
+	writeLogFile(t, base+".2026101810",
+		"2026/10/18 10:00:01 main.go:10: [notice] start",
+		"2026/10/18 10:30:00 main.go:20: [trace] method[POST] request done",
+	)
+	writeLogFile(t, base+".wf.2026101810.gz",
+		"2026/10/18 10:15:00 main.go:30: [warning] method[GET] request slow",
+	)
+	writeLogFile(t, base+".2026101811",
+		`{"time":"`+jsonTime("2026/10/18 11:05:00")+`","level":"notice","caller":"main.go:10","method":"POST","msg":"json request"}`,
+	)
+	writeLogFile(t, base+".wf.2026101811",
+		`{"time":"`+jsonTime("2026/10/18 11:10:00")+`","level":"fatal","caller":"main.go:40","retry":2,"msg":"json failed"}`,
+		"not a larix line",
+	)
+	os.Symlink("app.log.2026101811", base)
+	return base
+}
+
+func runLines(t *testing.T, opts *options, base string) []string {
+	var out bytes.Buffer
+	if err := run(context.Background(), opts, []string{base}, &out, io.Discard); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	res := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line != "" {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+func Test_RunMergeAndFilter(t *testing.T) {
+	base := writeTestLogs(t)
+
+	lines := runLines(t, &options{}, base)
+	want := []string{"start", "request slow", "request done", "json request", "json failed", "not a larix line"}
+	if len(lines) != len(want) {
+		t.Fatalf("lines = %q, want %d lines", lines, len(want))
+	}
+	for i, item := range want {
+		if !strings.Contains(lines[i], item) {
+			t.Errorf("line %d = %q, want %q", i, lines[i], item)
+		}
+	}
+
+	since, _ := parseTime("2026-10-18 10:20", time.Now())
+	until, _ := parseTime("2026101811", time.Now())
+	cases := []struct {
+		opts *options
+		want []string
+	}{
+		{&options{level: larix.LOG_WARN}, []string{"request slow", "json failed", "not a larix line"}},
+		{&options{fields: fieldFilters{{"method", "POST"}}}, []string{"request done", "json request"}},
+		{&options{fields: fieldFilters{{"retry", "2"}}}, []string{"json failed", "not a larix line"}},
+		{&options{since: since, until: until}, []string{"request done"}},
+	}
+	for _, item := range cases {
+		lines := runLines(t, item.opts, base)
+		if len(lines) != len(item.want) {
+			t.Errorf("lines with %+v = %q, want %q", item.opts, lines, item.want)
+			continue
+		}
+		for i := range item.want {
+			if !strings.Contains(lines[i], item.want[i]) {
+				t.Errorf("lines with %+v = %q, want %q", item.opts, lines, item.want)
+			}
+		}
+	}
+}
+
+//files moved by logrotate, the current file has the newest lines
+func Test_RunLogrotateFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "app.log")
+	writeLogFile(t, base+"-20261016", "2026/10/16 10:00:00 main.go:10: [notice] dated")
+	writeLogFile(t, base+".2.gz", "2026/10/17 10:00:00 main.go:10: [notice] second")
+	writeLogFile(t, base+".1", "2026/10/18 09:00:00 main.go:10: [notice] first")
+	writeLogFile(t, base, "2026/10/18 10:00:00 main.go:10: [notice] current")
+	writeLogFile(t, base+".wf.1", "2026/10/18 09:30:00 main.go:30: [warning] wf first")
+	writeLogFile(t, base+".wf", "2026/10/18 10:30:00 main.go:30: [warning] wf current")
+	writeLogFile(t, base+".bak", "2026/10/18 08:00:00 main.go:10: [notice] backup")
+
+	files, skipped := listLogFiles(base, false)
+	want := []string{base + "-20261016", base + ".2.gz", base + ".1", base}
+	if len(files) != len(want) {
+		t.Fatalf("files = %+v, want %q", files, want)
+	}
+	for i := range want {
+		if files[i].path != want[i] {
+			t.Errorf("file %d = %s, want %s", i, files[i].path, want[i])
+		}
+	}
+	if len(skipped) != 1 || skipped[0] != base+".bak" {
+		t.Errorf("skipped = %q, want [%s]", skipped, base+".bak")
+	}
+	if _, skipped := listLogFiles(base, true); len(skipped) != 0 {
+		t.Errorf("wf skipped = %q, want none", skipped)
+	}
+
+	var out, warn bytes.Buffer
+	if err := run(context.Background(), &options{}, []string{base}, &out, &warn); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	items := []string{"dated", "second", "first", "wf first", "current", "wf current"}
+	if len(lines) != len(items) {
+		t.Fatalf("lines = %q, want %q", lines, items)
+	}
+	for i, item := range items {
+		if !strings.HasSuffix(lines[i], "] "+item) {
+			t.Errorf("line %d = %q, want %q", i, lines[i], item)
+		}
+	}
+	if !strings.Contains(warn.String(), "skip "+base+".bak") {
+		t.Errorf("warn = %q, want skip of %s", warn.String(), base+".bak")
+	}
+
+	//the current file goes last in time range too
+	since, _ := parseTime("2026-10-18 09:45", time.Now())
+	lines = runLines(t, &options{since: since}, base)
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "] current") || !strings.HasSuffix(lines[1], "] wf current") {
+		t.Errorf("lines since %s = %q, want current ones", since, lines)
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func Test_RunFollow(t *testing.T) {
+	base := writeTestLogs(t)
+	since, _ := parseTime("2026-10-18 11:00", time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error)
+	go func() {
+		done <- run(ctx, &options{since: since, follow: true, interval: 10 * time.Millisecond}, []string{base}, out, io.Discard)
+	}()
+
+	waitFor := func(substr string) {
+		for i := 0; i < 200 && !strings.Contains(out.String(), substr); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !strings.Contains(out.String(), substr) {
+			t.Fatalf("output %q, want %q", out.String(), substr)
+		}
+	}
+	waitFor("json request")
+
+	//current file grows, then rotates
+	fd, _ := os.OpenFile(base+".2026101811", os.O_APPEND|os.O_WRONLY, 0644)
+	fd.WriteString("2026/10/18 11:59:59 main.go:10: [notice] appended\n")
+	fd.Close()
+	waitFor("appended")
+	writeLogFile(t, base+".2026101812", "2026/10/18 12:00:00 main.go:10: [notice] rotated")
+	waitFor("rotated")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run failed: %s", err)
+	}
+	if strings.Contains(out.String(), "start") {
+		t.Error("lines before since should not be printed")
+	}
+}
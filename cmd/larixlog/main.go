@@ -0,0 +1,131 @@
+package main
+
+/**
+ * larixlog read larix log files
+ *
+ *	larixlog [flags] file...
+ *
+ * file is File in larix.LogConf, like ./logs/app.log, its normal and wf
+ * files, rotated and gzipped ones are read and merged by time:
+ *	app.log  app.log.wf  app.log.2026101810  app.log.wf.2026101810.gz ...
+ * text and json lines are both understood, lines are printed as they are
+ *
+ *	larixlog -level warning -since 1h ./logs/app.log
+ *	larixlog -field method=POST -since "2026-10-18 10:00" -until "2026-10-18 11:00" ./logs/app.log
+ *	larixlog -f ./logs/app.log
+ **/
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kstrwind/lib-go/larix"
+)
+
+//time layouts of -since and -until, local time
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+	"2006010215",
+}
+
+type options struct {
+	//lowest level to print
+	level int
+
+	//time range, zero for no limit, until is excluded
+	since time.Time
+	until time.Time
+
+	fields fieldFilters
+
+	//follow current files across rotations
+	follow   bool
+	interval time.Duration
+}
+
+//fieldFilters -field key=value, may be repeated
+type fieldFilters []fieldFilter
+
+type fieldFilter struct {
+	key   string
+	value string
+}
+
+func (f *fieldFilters) String() string {
+	res := []string{}
+	for _, item := range *f {
+		res = append(res, item.key+"="+item.value)
+	}
+	return strings.Join(res, ",")
+}
+
+func (f *fieldFilters) Set(value string) error {
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 || pair[0] == "" {
+		return fmt.Errorf("field filter [%s] invalid, want key=value", value)
+	}
+	*f = append(*f, fieldFilter{key: pair[0], value: pair[1]})
+	return nil
+}
+
+func main() {
+	opts := &options{}
+	level := flag.String("level", "debug", "lowest level to print, like notice or warning")
+	since := flag.String("since", "", "print lines at or after time, like \"2026-10-18 10:00\" or 1h for an hour ago")
+	until := flag.String("until", "", "print lines before time, same format as since")
+	flag.Var(&opts.fields, "field", "print lines with field key=value, may be repeated")
+	flag.BoolVar(&opts.follow, "f", false, "follow current files, rotated files are followed too")
+	flag.DurationVar(&opts.interval, "interval", time.Second, "interval to check files when follow")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: larixlog [flags] file...\n\nfile is File in larix log conf, like ./logs/app.log\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	if opts.level, err = larix.ParseLogLevel(*level); err == nil {
+		if opts.since, err = parseTime(*since, time.Now()); err == nil {
+			opts.until, err = parseTime(*until, time.Now())
+		}
+	}
+	if err == nil && flag.NArg() == 0 {
+		err = fmt.Errorf("log file is required")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, opts, flag.Args(), os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+//parseTime time by layouts, or duration before now like 1h
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(strings.TrimPrefix(value, "-")); err == nil {
+		return now.Add(-duration), nil
+	}
+	for _, layout := range timeLayouts {
+		if res, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return res, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("time [%s] invalid", value)
+}
@@ -0,0 +1,125 @@
+package main
+
+/**
+ * larix log lines:
+ *	text: 2006/01/02 15:04:05 file.go:10[ func]: [level] fields and message
+ *	json: {"time":"2006-01-02T15:04:05.000Z07:00","level":"notice",...}
+ * text fields look like key[value]
+ **/
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kstrwind/lib-go/larix"
+)
+
+const (
+	textTimeLayout = "2006/01/02 15:04:05"
+	jsonTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+type record struct {
+	time  time.Time
+	level int
+
+	//fields of json line, values as strings
+	fields map[string]string
+
+	//line without "\n"
+	line string
+}
+
+//parseRecord parse a line, false if line is not a larix line
+func parseRecord(line string) (*record, bool) {
+	if strings.HasPrefix(line, "{") {
+		return parseJsonRecord(line)
+	}
+	return parseTextRecord(line)
+}
+
+func parseTextRecord(line string) (*record, bool) {
+	if len(line) < len(textTimeLayout) {
+		return nil, false
+	}
+	t, err := time.ParseInLocation(textTimeLayout, line[:len(textTimeLayout)], time.Local)
+	if err != nil {
+		return nil, false
+	}
+
+	//header ends before "[level]"
+	rest := line[len(textTimeLayout):]
+	start := strings.Index(rest, ": [")
+	if start < 0 {
+		return nil, false
+	}
+	rest = rest[start+3:]
+	end := strings.Index(rest, "]")
+	if end < 0 {
+		return nil, false
+	}
+	level, err := larix.ParseLogLevel(rest[:end])
+	if err != nil {
+		return nil, false
+	}
+
+	return &record{time: t, level: level, line: line}, true
+}
+
+func parseJsonRecord(line string) (*record, bool) {
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewBufferString(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, false
+	}
+
+	str, _ := values["time"].(string)
+	t, err := time.Parse(jsonTimeLayout, str)
+	if err != nil {
+		return nil, false
+	}
+	str, _ = values["level"].(string)
+	level, err := larix.ParseLogLevel(str)
+	if err != nil {
+		return nil, false
+	}
+
+	fields := map[string]string{}
+	for key, value := range values {
+		if str, ok := value.(string); ok {
+			fields[key] = str
+			continue
+		}
+		fields[key] = fmt.Sprint(value)
+	}
+	return &record{time: t, level: level, fields: fields, line: line}, true
+}
+
+//match check record by options
+func (r *record) match(opts *options) bool {
+	if r.level < opts.level {
+		return false
+	}
+	if !opts.since.IsZero() && r.time.Before(opts.since) {
+		return false
+	}
+	if !opts.until.IsZero() && !r.time.Before(opts.until) {
+		return false
+	}
+
+	for _, filter := range opts.fields {
+		if r.fields != nil {
+			if value, exists := r.fields[filter.key]; !exists || value != filter.value {
+				return false
+			}
+			continue
+		}
+		if !strings.Contains(r.line, " "+filter.key+"["+filter.value+"]") {
+			return false
+		}
+	}
+	return true
+}
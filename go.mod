@@ -2,6 +2,10 @@ module github.com/kstrwind/lib-go
 
 go 1.23.9
 
-require github.com/go-ini/ini v1.67.0
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/go-ini/ini v1.67.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require github.com/stretchr/testify v1.10.0 // indirect
@@ -6,159 +6,348 @@ package larix
  *
  **/
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
-
-	ini "github.com/go-ini/ini"
+	"sync"
 )
 
 //define conftype
 type LarixConf map[string]map[string]interface{}
 
-// use file suffix to determine dial  parser
+// use file suffix to determine dial  parser, see confparser.go
+// types registered by RegisterConfParser start from CONF_OVER
 const (
 	CONF_INI int = iota
 	CONF_YAML
-	CONF_GO
+	CONF_JSON
+	CONF_TOML
 	CONF_OVER
 )
 
-var dialConf map[string]int = map[string]int{
-	"ini":  CONF_INI,
-	"yml":  CONF_YAML,
-	"yaml": CONF_YAML,
-	"go":   CONF_GO,
-}
-
+// Conf hold loaded config files, methods are safe for concurrent use,
+// ConfigCache read directly is not guarded against reload
 type Conf struct {
 	//configfiles
 	ConfigFiles map[int][]string
 
 	//current parse conf content
 	ConfigCache LarixConf
+
+	//source which supplied each section key, section => key => source
+	//source is the file path, or env:NAME / flag:--section.key for overrides
+	sources map[string]map[string]string
+
+	//conf content parsed from files, before env and flag overrides
+	fileContent *confContent
+
+	//env var prefix and command line args for overrides, see confoverlay.go
+	envPrefix string
+	args      []string
+
+	//config paths given to init: files, directories or globs,
+	//"?" prefix marks optional ones, see ConfLoad
+	configs []string
+
+	//config files in load order including included ones,
+	//later files override earlier ones
+	loadOrder []string
+
+	//missing files are errors in strict mode, also when reload
+	strict bool
+
+	// ensure ConfigCache and sources swap atomic when reload
+	mu sync.RWMutex
+
+	// serialize conf rebuild, reload and overrides change
+	reloadMu sync.Mutex
+
+	//callbacks notified after reload
+	subscribers []ConfSubscriber
+}
+
+//parsed conf content, built aside and then swapped into Conf
+type confContent struct {
+	cache   LarixConf
+	sources map[string]map[string]string
+
+	//files in load order
+	order []string
+}
+
+func newConfContent() *confContent {
+	return &confContent{
+		cache:   LarixConf{},
+		sources: make(map[string]map[string]string),
+	}
 }
 
-//Conf instance
+//default Conf instance, used by package functions
 var _conf *Conf = nil
 
+// guard _conf replace
+var confMu sync.RWMutex
+
+func confDefault() *Conf {
+	confMu.RLock()
+	defer confMu.RUnlock()
+	return _conf
+}
+
+// ConfInit init the default conf instance, only the first call takes effect
+// errors are written to stderr, use ConfLoad to get them
 func ConfInit(configs []string) {
 	if len(configs) < 1 {
-		os.Stdout.WriteString("config files not set")
+		os.Stderr.WriteString("config files not set\n")
 		return
 	}
 
+	confMu.Lock()
+	defer confMu.Unlock()
 	if _conf != nil {
 		return
 	}
 
-	_conf = &Conf{
-		ConfigFiles: make(map[int][]string),
-		ConfigCache: LarixConf{},
+	c, errs := newConf(configs, false)
+	for _, err := range errs {
+		os.Stderr.WriteString(err.Error() + "\n")
 	}
+	_conf = c
 
-	// pasre config file type
-	for _, file := range configs {
-		tmp_res := strings.Split(file, ".")
-		r_suffix := tmp_res[len(tmp_res)-1]
-		r_type, exists := dialConf[r_suffix]
-		if !exists {
-			os.Stdout.WriteString("config file [" + file + "] type [" + r_suffix + "] not support")
-		} else {
-			/*
-				_, exists := _conf.ConfigFiles[r_type]
-				if !exists {
-					_conf.ConfigFiles[r_type] = make([]string)
-				}*/
-			_conf.ConfigFiles[r_type] = append(_conf.ConfigFiles[r_type], file)
-		}
+	return
+}
+
+// ConfLoad init the default conf instance and return all file errors in one ConfError,
+// config is not installed when any error
+// configs may be files, directories or globs, see confinclude.go
+// in strict mode missing files and not supported file types are errors,
+// otherwise they are skipped; files with "?" prefix, like "?./conf/local.ini",
+// are optional and allowed to be absent in both modes
+func ConfLoad(configs []string, strict bool) error {
+	if len(configs) < 1 {
+		return errors.New("config files not set")
+	}
+
+	confMu.Lock()
+	defer confMu.Unlock()
+	if _conf != nil {
+		return errors.New("conf already init, call ConfReset before load again")
+	}
+
+	c, errs := newConf(configs, strict)
+	if err := confErrors(errs, strict, nil); err != nil {
+		return err
+	}
+	_conf = c
+	return nil
+}
+
+// ConfReset drop the default conf instance, so ConfInit can be called again
+// mostly for tests
+func ConfReset() {
+	confMu.Lock()
+	defer confMu.Unlock()
+	_conf = nil
+}
+
+// NewConf create a conf instance independent of the default one, files are
+// loaded in strict mode, see ConfLoad
+func NewConf(files ...string) (*Conf, error) {
+	if len(files) < 1 {
+		return nil, errors.New("config files not set")
+	}
+
+	c, errs := newConf(files, true)
+	if err := confErrors(errs, true, nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//newConf create conf and load files, files with errors are skipped and all errors returned
+func newConf(configs []string, strict bool) (*Conf, []*ConfFileError) {
+	c := &Conf{
+		ConfigFiles: make(map[int][]string),
+		ConfigCache: LarixConf{},
+		sources:     make(map[string]map[string]string),
+		configs:     append([]string{}, configs...),
+		strict:      strict,
 	}
 
 	//load conf
-	for c_type, c_files := range _conf.ConfigFiles {
-		if c_type == CONF_INI {
-			loadIni(c_files)
-		} else if c_type == CONF_YAML {
-			loadYaml(c_files)
-		} else if c_type == CONF_GO {
-			loadGo(c_files)
-		} else {
-			os.Stderr.WriteString(fmt.Sprintf("unknoen conf type %d, will not load", c_type))
+	content, errs := c.parseFiles()
+	c.fileContent = content
+	c.setContent(c.overlay(content))
+
+	return c, errs
+}
+
+//setContent replace conf content, caller hold mu when c is in use
+func (c *Conf) setContent(content *confContent) {
+	c.ConfigCache = content.cache
+	c.sources = content.sources
+	c.loadOrder = content.order
+
+	c.ConfigFiles = make(map[int][]string)
+	loaded := make(map[string]bool)
+	for _, file := range content.order {
+		if loaded[file] {
+			continue
 		}
+		loaded[file] = true
+		r_type, _ := confType(file)
+		c.ConfigFiles[r_type] = append(c.ConfigFiles[r_type], file)
 	}
+}
 
-	return
+//confType get conf type by file suffix, -1 for not support
+func confType(file string) (int, string) {
+	tmp_res := strings.Split(file, ".")
+	r_suffix := tmp_res[len(tmp_res)-1]
+
+	confParsersMu.RLock()
+	defer confParsersMu.RUnlock()
+	r_type, exists := dialConf[strings.ToLower(r_suffix)]
+	if !exists {
+		return -1, r_suffix
+	}
+	return r_type, r_suffix
 }
 
-func loadIni(configs []string) {
-	//step1: load config files
-	//current not close fgf
-	cfg := ini.Empty()
+//parseFiles load config paths in order into a new conf content, file failed
+//to load is skipped and its error returned, optional missing files are ignored
+func (c *Conf) parseFiles() (*confContent, []*ConfFileError) {
+	content := newConfContent()
+	errs := []*ConfFileError{}
+
+	for _, config := range c.configs {
+		optional := strings.HasPrefix(config, "?")
+		path := strings.TrimPrefix(config, "?")
 
-	for _, file := range configs {
-		//check if file exists
-		_, err := os.Stat(file)
-		//here we can't use os.IsExist, because when file exist, err is nil, ca't use it to check file exists
-		if err != nil && os.IsNotExist(err) {
-			os.Stderr.WriteString("config file [" + file + "] not exists")
+		files, is_pattern, err := expandConfPath(path)
+		if err != nil {
+			errs = append(errs, &ConfFileError{File: path, Err: err})
 			continue
 		}
 
-		err = cfg.Append(file)
-		if err != nil {
-			os.Stderr.WriteString("load config file [" + file + "] failed")
+		//directory and glob only pick supported files, and may be empty
+		if !is_pattern {
+			r_type, r_suffix := confType(path)
+			if r_type < 0 {
+				errs = append(errs, &ConfFileError{File: path, Err: fmt.Errorf("%w: %s", ErrConfNotSupport, r_suffix)})
+				continue
+			}
+
+			//check if file exists
+			_, err := os.Stat(path)
+			//here we can't use os.IsExist, because when file exist, err is nil, ca't use it to check file exists
+			if err != nil && os.IsNotExist(err) {
+				if !optional {
+					errs = append(errs, &ConfFileError{File: path, Err: ErrConfNotExist})
+				}
+				continue
+			}
+		}
+
+		for _, file := range files {
+			errs = append(errs, content.load(file, nil)...)
 		}
 	}
 
-	//parse config
-	sections := cfg.SectionStrings()
+	return content, errs
+}
 
-	for _, section := range sections {
-		lower_section := strings.ToLower(section)
-		keys := cfg.Section(section).KeyStrings()
+//load parse file by its type parser, later files override earlier ones,
+//files included by it are loaded first, stack is the include chain
+func (c *confContent) load(file string, stack []string) []*ConfFileError {
+	c_type, r_suffix := confType(file)
+	parser := confParserOf(c_type)
+	if parser == nil {
+		return []*ConfFileError{{File: file, Err: fmt.Errorf("%w: %s", ErrConfNotSupport, r_suffix)}}
+	}
 
-		_, exists := _conf.ConfigCache[lower_section]
-		if !exists {
-			_conf.ConfigCache[lower_section] = make(map[string]interface{})
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*ConfFileError{{File: file, Err: ErrConfNotExist}}
 		}
+		return []*ConfFileError{{File: file, Err: fmt.Errorf("load failed: %s", err.Error())}}
+	}
+
+	values, err := parser(data)
+	if err != nil {
+		return []*ConfFileError{{File: file, Err: fmt.Errorf("parse failed: %s", err.Error())}}
+	}
 
-		for _, key := range keys {
-			lower_key := strings.ToLower(key)
-			_conf.ConfigCache[lower_section][lower_key] = cfg.Section(section).Key(key).Value()
+	errs := c.loadIncludes(file, takeIncludes(values), stack)
 
+	for section, keys := range values {
+		lower_section := strings.ToLower(section)
+		c.addSection(lower_section)
+		for key, value := range keys {
+			c.set(lower_section, strings.ToLower(key), value, file)
 		}
 	}
-
+	c.order = append(c.order, file)
+	return errs
 }
 
-func loadYaml(configs []string) {
+func (c *confContent) addSection(section string) {
+	_, exists := c.cache[section]
+	if !exists {
+		c.cache[section] = make(map[string]interface{})
+	}
 }
 
-func loadGo(configs []string) {
+func (c *confContent) set(section string, key string, value interface{}, file string) {
+	c.addSection(section)
+	c.cache[section][key] = value
+
+	_, exists := c.sources[section]
+	if !exists {
+		c.sources[section] = make(map[string]string)
+	}
+	c.sources[section][key] = file
 }
 
 //get all sections
 func GetSectionsKeys() []string {
+	return confDefault().GetSectionsKeys()
+}
+
+//Get section all keys and values
+func GetSection(section string) map[string]interface{} {
+	return confDefault().GetSection(section)
+}
+
+// GetSectionsKeys get all sections
+func (c *Conf) GetSectionsKeys() []string {
 	res := []string{}
-	if _conf == nil || len(_conf.ConfigCache) == 0 {
+	if c == nil {
 		return res
 	}
 
-	for key, _ := range _conf.ConfigCache {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for key, _ := range c.ConfigCache {
 		res = append(res, key)
 	}
 	//sort.Sort(res)
 	return res
 }
 
-//Get section all keys and values
-func GetSection(section string) map[string]interface{} {
-	//res := make(map[string]interface{})
-	if _conf == nil || len(_conf.ConfigCache) == 0 {
+// GetSection get section all keys and values
+func (c *Conf) GetSection(section string) map[string]interface{} {
+	if c == nil {
 		return map[string]interface{}{}
 	}
 
-	res, exists := _conf.ConfigCache[section]
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res, exists := c.ConfigCache[section]
 	if !exists {
 		return map[string]interface{}{}
 	}
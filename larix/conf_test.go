@@ -0,0 +1,439 @@
+package larix
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfFile(t *testing.T, name string, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file %s failed: %s", file, err)
+	}
+	return file
+}
+
+//registerTestConfParser RegisterConfParser, registry is restored when test done
+func registerTestConfParser(t *testing.T, suffixes []string, parser ConfParser) int {
+	confParsersMu.Lock()
+	types := make(map[string]int, len(dialConf))
+	for suffix, c_type := range dialConf {
+		types[suffix] = c_type
+	}
+	parsers := make(map[int]ConfParser, len(confParsers))
+	for c_type, parser := range confParsers {
+		parsers[c_type] = parser
+	}
+	next := confTypeNext
+	confParsersMu.Unlock()
+
+	t.Cleanup(func() {
+		confParsersMu.Lock()
+		defer confParsersMu.Unlock()
+		dialConf, confParsers, confTypeNext = types, parsers, next
+	})
+	return RegisterConfParser(suffixes, parser)
+}
+
+func Test_ConfLoadYaml(t *testing.T) {
+	ConfReset()
+	defer ConfReset()
+
+	file := writeConfFile(t, "test.yaml", `
+name: demo
+Server:
+  Host: 127.0.0.1
+  Port: 8080
+  Tags: [a, b]
+  TLS:
+    Enable: true
+`)
+	ConfInit([]string{file})
+
+	if v := GetSection("default")["name"]; v != "demo" {
+		t.Errorf("default.name = %v, want demo", v)
+	}
+
+	server := GetSection("server")
+	if server["host"] != "127.0.0.1" || server["port"] != 8080 {
+		t.Errorf("server section = %v", server)
+	}
+	if !reflect.DeepEqual(server["tags"], []interface{}{"a", "b"}) {
+		t.Errorf("server.tags = %v", server["tags"])
+	}
+	if v := GetSection("server.tls")["enable"]; v != true {
+		t.Errorf("server.tls.enable = %v, want true", v)
+	}
+}
+
+func Test_ConfTypedGetters(t *testing.T) {
+	ConfReset()
+	defer ConfReset()
+
+	file := writeConfFile(t, "test.ini", `
+[server]
+port = 8080
+debug = on
+timeout = 1500ms
+hosts = a, b ,c
+bad_port = eighty
+`)
+	ConfInit([]string{file})
+
+	if v := GetInt("Server", "Port", 0); v != 8080 {
+		t.Errorf("GetInt = %d, want 8080", v)
+	}
+	if v := GetBool("server", "debug", false); !v {
+		t.Errorf("GetBool = %v, want true", v)
+	}
+	if v := GetDuration("server", "timeout", 0); v != 1500*time.Millisecond {
+		t.Errorf("GetDuration = %v, want 1.5s", v)
+	}
+	if v := GetStringSlice("server", "hosts", nil); !reflect.DeepEqual(v, []string{"a", "b", "c"}) {
+		t.Errorf("GetStringSlice = %v", v)
+	}
+	if v := GetString("server", "missing", "def"); v != "def" {
+		t.Errorf("GetString default = %s, want def", v)
+	}
+
+	_, err := MustInt("server", "bad_port")
+	if err == nil || !strings.Contains(err.Error(), file) || !strings.Contains(err.Error(), "bad_port") {
+		t.Errorf("MustInt error = %v, want section, key and file", err)
+	}
+
+	//yaml numbers out of int range are not wrapped
+	for _, value := range []interface{}{uint64(math.MaxUint64), float64(1 << 63), -float64(1 << 64), 1.5} {
+		if res, err := toInt(value); err == nil {
+			t.Errorf("toInt(%v) = %d, want error", value, res)
+		}
+	}
+	if res, err := toInt(float64(-1 << 63)); err != nil || res != math.MinInt {
+		t.Errorf("toInt(-2^63) = %d, %v", res, err)
+	}
+}
+
+func Test_ConfUnmarshalSection(t *testing.T) {
+	ConfReset()
+	defer ConfReset()
+
+	file := writeConfFile(t, "test.ini", `
+[server]
+host = 127.0.0.1
+tags = a,b
+port = eighty
+
+[server.tls]
+cert = ./server.pem
+`)
+	ConfInit([]string{file})
+
+	type tlsConf struct {
+		Cert string `ini:"cert"`
+	}
+	type serverConf struct {
+		Host    string        `ini:"host" required:"true"`
+		Port    int           `ini:"port"`
+		Timeout time.Duration `ini:"timeout" default:"2s"`
+		Tags    []string      `ini:"tags"`
+		User    string        `ini:"user" required:"true"`
+		TLS     tlsConf       `ini:"tls"`
+	}
+
+	var conf serverConf
+	err := UnmarshalSection("server", &conf)
+	if err == nil {
+		t.Fatal("UnmarshalSection should fail on port and user")
+	}
+	if !strings.Contains(err.Error(), "port") || !strings.Contains(err.Error(), "user") {
+		t.Errorf("error should list all invalid fields, got: %s", err)
+	}
+
+	if conf.Host != "127.0.0.1" || conf.Timeout != 2*time.Second || conf.TLS.Cert != "./server.pem" {
+		t.Errorf("decoded conf = %+v", conf)
+	}
+	if !reflect.DeepEqual(conf.Tags, []string{"a", "b"}) {
+		t.Errorf("decoded tags = %v", conf.Tags)
+	}
+}
+
+func Test_ConfReload(t *testing.T) {
+	ConfReset()
+	defer ConfReset()
+
+	file := writeConfFile(t, "test.ini", "[server]\nhost = a\nport = 80\n")
+	ConfInit([]string{file})
+
+	var got map[string]*ConfDiff
+	ConfSubscribe(func(diff map[string]*ConfDiff) {
+		got = diff
+	})
+
+	os.WriteFile(file, []byte("[server]\nhost = b\nuser = root\n"), 0644)
+	if err := ConfReload(); err != nil {
+		t.Fatalf("ConfReload failed: %s", err)
+	}
+	want := map[string]*ConfDiff{
+		"server": {Added: []string{"user"}, Removed: []string{"port"}, Changed: []string{"host"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reload diff = %+v, want %+v", got["server"], want["server"])
+	}
+
+	//broken file keeps previous conf
+	os.WriteFile(file, []byte("[server\nhost = c\n"), 0644)
+	if err := ConfReload(); err == nil {
+		t.Error("ConfReload should fail on broken file")
+	}
+	if v := GetString("server", "host", ""); v != "b" {
+		t.Errorf("server.host = %s after failed reload, want b", v)
+	}
+
+	//loaded file missing for a moment keeps previous conf, optional one may go away
+	ConfReset()
+	local := writeConfFile(t, "local.ini", "[local]\nname = l\n")
+	ConfInit([]string{file, "?" + local, "missing.ini"})
+	os.WriteFile(file, []byte("[server]\nhost = d\n"), 0644)
+	os.Remove(local)
+	if err := ConfReload(); err != nil {
+		t.Fatalf("ConfReload without optional file failed: %s", err)
+	}
+	if v := GetString("local", "name", ""); v != "" {
+		t.Errorf("local.name = %s after optional file removed", v)
+	}
+	os.Remove(file)
+	if err := ConfReload(); !errors.Is(err, ErrConfNotExist) {
+		t.Errorf("ConfReload with loaded file missing err = %v", err)
+	}
+	if v := GetString("server", "host", ""); v != "d" {
+		t.Errorf("server.host = %s after loaded file missing, want d", v)
+	}
+}
+
+func Test_NewConf(t *testing.T) {
+	first, err := NewConf(writeConfFile(t, "first.ini", "[server]\nhost = a\n"))
+	if err != nil {
+		t.Fatalf("NewConf failed: %s", err)
+	}
+	second, err := NewConf(writeConfFile(t, "second.yaml", "server:\n  host: b\n"))
+	if err != nil {
+		t.Fatalf("NewConf failed: %s", err)
+	}
+
+	if v := first.GetString("server", "host", ""); v != "a" {
+		t.Errorf("first server.host = %s, want a", v)
+	}
+	if v := second.GetString("server", "host", ""); v != "b" {
+		t.Errorf("second server.host = %s, want b", v)
+	}
+
+	_, err = NewConf("missing.ini", "test.conf")
+	if err == nil || !strings.Contains(err.Error(), "missing.ini") || !strings.Contains(err.Error(), "test.conf") {
+		t.Errorf("NewConf error = %v, want both bad files", err)
+	}
+}
+
+func Test_ConfOverrides(t *testing.T) {
+	file := writeConfFile(t, "test.ini", `
+[server]
+host = 127.0.0.1
+port = 80
+user = ${LARIX_TEST_USER}
+url = http://${server.host}:${server.port}/
+`)
+	c, err := NewConf(file)
+	if err != nil {
+		t.Fatalf("NewConf failed: %s", err)
+	}
+
+	t.Setenv("LARIX_TEST_USER", "root")
+	t.Setenv("LARIX_TEST_SERVER__PORT", "8080")
+	c.SetEnvPrefix("LARIX_TEST")
+	c.SetArgs([]string{"-v", "--server.host=10.0.0.1"})
+
+	if v := c.GetString("server", "url", ""); v != "http://10.0.0.1:8080/" {
+		t.Errorf("server.url = %s", v)
+	}
+	if v := c.GetString("server", "user", ""); v != "root" {
+		t.Errorf("server.user = %s, want root", v)
+	}
+
+	sources := map[string]string{
+		"host": "flag:--server.host",
+		"port": "env:LARIX_TEST_SERVER__PORT",
+		"user": file,
+	}
+	for key, want := range sources {
+		if v := c.GetSource("server", key); v != want {
+			t.Errorf("source of server.%s = %s, want %s", key, v, want)
+		}
+	}
+}
+
+func Test_ConfLoadErrors(t *testing.T) {
+	ConfReset()
+	defer ConfReset()
+
+	file := writeConfFile(t, "test.ini", "[server]\nhost = a\n")
+	broken := writeConfFile(t, "broken.yaml", "server: [a\n")
+
+	//optional missing file and unknown suffix are fine in non strict mode
+	err := ConfLoad([]string{file, "?missing.ini", "test.conf"}, false)
+	if err != nil {
+		t.Fatalf("ConfLoad failed: %s", err)
+	}
+	ConfReset()
+
+	err = ConfLoad([]string{file, "missing.ini", "test.conf", broken, "?optional.ini"}, true)
+	var conf_err *ConfError
+	if !errors.As(err, &conf_err) || len(conf_err.Errors) != 3 {
+		t.Fatalf("ConfLoad error = %v, want 3 file errors", err)
+	}
+	if !errors.Is(err, ErrConfNotExist) || !errors.Is(err, ErrConfNotSupport) {
+		t.Errorf("ConfLoad error should wrap missing and not support errors: %s", err)
+	}
+	if len(GetSectionsKeys()) != 0 {
+		t.Error("conf should not be installed when ConfLoad failed")
+	}
+}
+
+func Test_ConfParsers(t *testing.T) {
+	json_file := writeConfFile(t, "test.json", `{"name": "demo", "server": {"port": 8080, "tls": {"enable": true}}}`)
+	toml_file := writeConfFile(t, "test.toml", "[server]\nhost = \"127.0.0.1\"\ntags = [\"a\", \"b\"]\n")
+
+	c_type := registerTestConfParser(t, []string{".kv"}, func(data []byte) (LarixConf, error) {
+		res := LarixConf{"kv": {}}
+		for _, line := range strings.Split(string(data), "\n") {
+			pair := strings.SplitN(line, "=", 2)
+			if len(pair) == 2 {
+				res["kv"][pair[0]] = pair[1]
+			}
+		}
+		return res, nil
+	})
+	kv_file := writeConfFile(t, "test.kv", "Key=value\n")
+
+	c, err := NewConf(json_file, toml_file, kv_file)
+	if err != nil {
+		t.Fatalf("NewConf failed: %s", err)
+	}
+
+	if v := c.GetInt("server", "port", 0); v != 8080 {
+		t.Errorf("server.port = %d, want 8080", v)
+	}
+	if v := c.GetBool("server.tls", "enable", false); !v {
+		t.Errorf("server.tls.enable = %v, want true", v)
+	}
+	if v := c.GetString("default", "name", ""); v != "demo" {
+		t.Errorf("default.name = %s, want demo", v)
+	}
+	if v := c.GetStringSlice("server", "tags", nil); !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Errorf("server.tags = %v", v)
+	}
+	if v := c.GetString("kv", "key", ""); v != "value" {
+		t.Errorf("kv.key = %s, want value", v)
+	}
+	if len(c.ConfigFiles[c_type]) != 1 {
+		t.Errorf("ConfigFiles[%d] = %v, want the kv file", c_type, c.ConfigFiles[c_type])
+	}
+
+	//registry restored after test, taken over suffix back to built-in parser
+	t.Run("restore", func(t *testing.T) {
+		registerTestConfParser(t, []string{"ini"}, parseJson)
+	})
+	if r_type, _ := confType("test.ini"); r_type != CONF_INI {
+		t.Errorf("ini conf type = %d after restore, want %d", r_type, CONF_INI)
+	}
+}
+
+func Test_ConfDirAndInclude(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "conf.d"), 0755)
+	files := map[string]string{
+		"base.ini":         "[server]\nhost = base\nport = 80\n",
+		"main.ini":         "include = base.ini\n[server]\nhost = main\n",
+		"conf.d/10-a.ini":  "[server]\nport = 81\n",
+		"conf.d/20-b.yaml": "server:\n  port: 82\n",
+		"conf.d/README":    "not a conf",
+		"cycle/a.ini":      "include = b.ini\n",
+		"cycle/b.ini":      "include = a.ini\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	c, err := NewConf(filepath.Join(dir, "main.ini"), filepath.Join(dir, "conf.d"))
+	if err != nil {
+		t.Fatalf("NewConf failed: %s", err)
+	}
+	if v := c.GetString("server", "host", ""); v != "main" {
+		t.Errorf("server.host = %s, want main", v)
+	}
+	if v := c.GetInt("server", "port", 0); v != 82 {
+		t.Errorf("server.port = %d, want 82", v)
+	}
+	if v := c.GetSource("server", "port"); v != filepath.Join(dir, "conf.d/20-b.yaml") {
+		t.Errorf("source of server.port = %s", v)
+	}
+
+	want := []string{"base.ini", "main.ini", "conf.d/10-a.ini", "conf.d/20-b.yaml"}
+	for i := range want {
+		want[i] = filepath.Join(dir, want[i])
+	}
+	if v := c.LoadOrder(); !reflect.DeepEqual(v, want) {
+		t.Errorf("LoadOrder = %v, want %v", v, want)
+	}
+
+	_, err = NewConf(filepath.Join(dir, "cycle/*.ini"))
+	if !errors.Is(err, ErrConfCycle) {
+		t.Errorf("NewConf error = %v, want include cycle", err)
+	}
+}
+
+func Test_ConfValidateAndDump(t *testing.T) {
+	c, err := NewConf(writeConfFile(t, "test.ini", `
+[server]
+host = 127.0.0.1
+port = 70000
+mode = test
+passwd = 123456
+`))
+	if err != nil {
+		t.Fatalf("NewConf failed: %s", err)
+	}
+
+	err = c.Validate(ConfSchema{
+		"server": {
+			"host":    "string,required",
+			"port":    "int,required,min=1,max=65535",
+			"mode":    "string,in=debug|release",
+			"user":    "string,required",
+			"timeout": "duration,max=30s",
+		},
+	})
+	if err == nil {
+		t.Fatal("Validate should fail")
+	}
+	for _, key := range []string{"port", "mode", "user"} {
+		if !strings.Contains(err.Error(), "key ["+key+"]") {
+			t.Errorf("Validate error should contain key %s: %s", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "key [host]") {
+		t.Errorf("Validate error should not contain host: %s", err)
+	}
+
+	var out strings.Builder
+	if err := c.Dump(&out, "ini"); err != nil {
+		t.Fatalf("Dump failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "passwd = ******") || strings.Contains(out.String(), "123456") {
+		t.Errorf("Dump should mask passwd:\n%s", out.String())
+	}
+}
@@ -0,0 +1,200 @@
+package larix
+
+/**
+ * decode conf section into tagged struct, like:
+ *
+ *	type ServerConf struct {
+ *		Host    string        `ini:"host" required:"true"`
+ *		Port    int           `ini:"port" default:"8080"`
+ *		Timeout time.Duration `ini:"timeout" default:"2s"`
+ *		Tags    []string      `ini:"tags"`
+ *		TLS     TLSConf       `ini:"tls"` //read from section "server.tls"
+ *	}
+ *
+ * fields without ini tag use lower case field name, `ini:"-"` skip the field
+ * types implementing encoding.TextUnmarshaler parse values themselves, like LogLevel
+ **/
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// UnmarshalSection see Conf.UnmarshalSection, read from default conf
+func UnmarshalSection(section string, out interface{}) error {
+	return confDefault().UnmarshalSection(section, out)
+}
+
+// UnmarshalSection fill out with section values, out must be a pointer to struct
+// all invalid and missing required fields are returned in one error
+func (c *Conf) UnmarshalSection(section string, out interface{}) error {
+	value := reflect.ValueOf(out)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal section [%s] failed: out must be a non-nil pointer to struct, got %T", section, out)
+	}
+
+	errs := []error{}
+	c.unmarshalStruct(strings.ToLower(section), value.Elem(), &errs)
+	return errors.Join(errs...)
+}
+
+func (c *Conf) unmarshalStruct(section string, value reflect.Value, errs *[]error) {
+	r_type := value.Type()
+
+	for i := 0; i < r_type.NumField(); i++ {
+		field := r_type.Field(i)
+		//unexported fields
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Tag.Get("ini")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		name = strings.ToLower(name)
+		field_value := value.Field(i)
+
+		//nested struct read from sub section
+		if isSubSection(field.Type) {
+			if field_value.Kind() == reflect.Ptr {
+				if field_value.IsNil() {
+					field_value.Set(reflect.New(field.Type.Elem()))
+				}
+				field_value = field_value.Elem()
+			}
+			c.unmarshalStruct(section+"."+name, field_value, errs)
+			continue
+		}
+
+		conf_value, file, err := c.lookup(section, name)
+		if err != nil {
+			def, has_def := field.Tag.Lookup("default")
+			if has_def {
+				conf_value, file = def, "default tag"
+			} else if field.Tag.Get("required") == "true" {
+				*errs = append(*errs, fmt.Errorf("conf section [%s] key [%s] is required", section, name))
+				continue
+			} else {
+				continue
+			}
+		}
+
+		err = setField(field_value, conf_value)
+		if err != nil {
+			*errs = append(*errs, confValueError(section, name, file, err))
+		}
+	}
+}
+
+func isSubSection(r_type reflect.Type) bool {
+	if r_type.Kind() == reflect.Ptr {
+		r_type = r_type.Elem()
+	}
+	return r_type.Kind() == reflect.Struct && r_type != reflect.TypeOf(time.Time{})
+}
+
+func setField(field reflect.Value, value interface{}) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return setField(field.Elem(), value)
+	}
+
+	if field.CanAddr() {
+		if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			str, err := toString(value)
+			if err != nil {
+				return err
+			}
+			return unmarshaler.UnmarshalText([]byte(strings.TrimSpace(str)))
+		}
+	}
+
+	if field.Type() == durationType {
+		res, err := toDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(res))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		res, err := toString(value)
+		if err != nil {
+			return err
+		}
+		field.SetString(res)
+
+	case reflect.Bool:
+		res, err := toBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(res)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		str, err := toString(value)
+		if err != nil {
+			return err
+		}
+		res, err := strconv.ParseInt(strings.TrimSpace(str), 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("value [%v] is not a %s", value, field.Type())
+		}
+		field.SetInt(res)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		str, err := toString(value)
+		if err != nil {
+			return err
+		}
+		res, err := strconv.ParseUint(strings.TrimSpace(str), 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("value [%v] is not a %s", value, field.Type())
+		}
+		field.SetUint(res)
+
+	case reflect.Float32, reflect.Float64:
+		str, err := toString(value)
+		if err != nil {
+			return err
+		}
+		res, err := strconv.ParseFloat(strings.TrimSpace(str), field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("value [%v] is not a %s", value, field.Type())
+		}
+		field.SetFloat(res)
+
+	case reflect.Slice:
+		items, err := toStringSlice(value)
+		if err != nil {
+			return err
+		}
+		res := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			err = setField(res.Index(i), item)
+			if err != nil {
+				return err
+			}
+		}
+		field.Set(res)
+
+	default:
+		return fmt.Errorf("field type %s not support", field.Type())
+	}
+
+	return nil
+}
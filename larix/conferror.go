@@ -0,0 +1,79 @@
+package larix
+
+import (
+	"errors"
+	"strings"
+)
+
+// config file errors, check with errors.Is
+var (
+	ErrConfNotExist   = errors.New("file not exists")
+	ErrConfNotSupport = errors.New("file type not support")
+	ErrConfCycle      = errors.New("include cycle")
+)
+
+// ConfFileError error of one config file
+type ConfFileError struct {
+	File string
+	Err  error
+}
+
+func (e *ConfFileError) Error() string {
+	return "config file [" + e.File + "] " + e.Err.Error()
+}
+
+func (e *ConfFileError) Unwrap() error {
+	return e.Err
+}
+
+// ConfError all errors when loading config files
+type ConfError struct {
+	Errors []*ConfFileError
+}
+
+func (e *ConfError) Error() string {
+	var res strings.Builder
+	res.WriteString("load conf failed:")
+	for _, err := range e.Errors {
+		res.WriteString("\n\t" + err.Error())
+	}
+	return res.String()
+}
+
+// Unwrap let errors.Is and errors.As check every file error
+func (e *ConfError) Unwrap() []error {
+	res := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		res = append(res, err)
+	}
+	return res
+}
+
+//confErrors filter file errors, in non strict mode missing and not
+//supported files are ignored, except files in loaded, which were loaded
+//before reload; nil when nothing left
+func confErrors(errs []*ConfFileError, strict bool, loaded []string) error {
+	was_loaded := make(map[string]bool, len(loaded))
+	for _, file := range loaded {
+		was_loaded[file] = true
+	}
+
+	res := &ConfError{}
+	for _, err := range errs {
+		//a file loaded before may be missing for a moment, like deleted and
+		//written again, don't take it as removed
+		if errors.Is(err, ErrConfNotExist) && was_loaded[err.File] {
+			res.Errors = append(res.Errors, err)
+			continue
+		}
+		if !strict && (errors.Is(err, ErrConfNotExist) || errors.Is(err, ErrConfNotSupport)) {
+			continue
+		}
+		res.Errors = append(res.Errors, err)
+	}
+
+	if len(res.Errors) == 0 {
+		return nil
+	}
+	return res
+}
@@ -0,0 +1,149 @@
+package larix
+
+/**
+ * config paths and include directive
+ *
+ * a config path may be a file, a directory or a glob like "conf.d/*.ini",
+ * files in directory and glob are loaded in lexical order, only files
+ * with supported suffix are picked
+ *
+ * a file includes other files by key "include" in the default section:
+ *
+ *	include = base.ini, conf.d
+ *
+ * include paths are relative to the including file, included files are
+ * loaded before the including one, so its own keys win
+ **/
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ini "github.com/go-ini/ini"
+)
+
+const confIncludeKey = "include"
+
+// ConfLoadOrder see Conf.LoadOrder, for default conf
+func ConfLoadOrder() []string {
+	return confDefault().LoadOrder()
+}
+
+// LoadOrder get config files in load order, later files override earlier ones,
+// use GetSource to get which file supplied a key
+func (c *Conf) LoadOrder() []string {
+	if c == nil {
+		return []string{}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string{}, c.loadOrder...)
+}
+
+//expandConfPath expand directory and glob into sorted supported files,
+//is_pattern is false for a plain file path
+func expandConfPath(path string) (files []string, is_pattern bool, err error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, true, err
+		}
+		sort.Strings(matches)
+		return supportedConfFiles(matches), true, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	//not a directory, take it as a file
+	if err != nil {
+		return []string{path}, false, nil
+	}
+
+	matches := []string{}
+	for _, entry := range entries {
+		matches = append(matches, filepath.Join(path, entry.Name()))
+	}
+	//ReadDir already sorted by name
+	return supportedConfFiles(matches), true, nil
+}
+
+func supportedConfFiles(paths []string) []string {
+	res := []string{}
+	for _, path := range paths {
+		if r_type, _ := confType(path); r_type < 0 {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		res = append(res, path)
+	}
+	return res
+}
+
+//takeIncludes remove include key from default section and return its paths
+func takeIncludes(values LarixConf) []string {
+	res := []string{}
+	for section, keys := range values {
+		if !strings.EqualFold(section, ini.DefaultSection) {
+			continue
+		}
+		for key, value := range keys {
+			if !strings.EqualFold(key, confIncludeKey) {
+				continue
+			}
+			delete(keys, key)
+			paths, err := toStringSlice(value)
+			if err == nil {
+				res = append(res, paths...)
+			}
+		}
+	}
+	return res
+}
+
+//loadIncludes load files included by file, include cycle is an error
+func (c *confContent) loadIncludes(file string, includes []string, stack []string) []*ConfFileError {
+	errs := []*ConfFileError{}
+	if len(includes) == 0 {
+		return errs
+	}
+
+	abs_file, _ := filepath.Abs(file)
+	stack = append(append([]string{}, stack...), abs_file)
+	base := filepath.Dir(file)
+
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(base, include)
+		}
+
+		files, _, err := expandConfPath(include)
+		if err != nil {
+			errs = append(errs, &ConfFileError{File: file, Err: fmt.Errorf("include [%s] failed: %s", include, err.Error())})
+			continue
+		}
+
+		for _, included := range files {
+			abs_included, _ := filepath.Abs(included)
+			if confInStack(stack, abs_included) {
+				chain := strings.Join(append(stack, abs_included), " -> ")
+				errs = append(errs, &ConfFileError{File: file, Err: fmt.Errorf("%w: %s", ErrConfCycle, chain)})
+				continue
+			}
+			errs = append(errs, c.load(included, stack)...)
+		}
+	}
+	return errs
+}
+
+func confInStack(stack []string, file string) bool {
+	for _, item := range stack {
+		if item == file {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package larix
+
+/**
+ * conf overrides, precedence from low to high:
+ *	1. config files
+ *	2. env vars:  PREFIX_SECTION__KEY=value, like APP_SERVER__PORT=8080
+ *	3. flags:     --section.key=value, like --server.port=8080
+ *
+ * after overrides, ${ENV_VAR} and ${section.key} in string values are
+ * replaced, references not found are kept as they are
+ **/
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// max depth of ${section.key} referring to another reference
+const confInterpolateDepth = 10
+
+var confRefReg = regexp.MustCompile(`\$\{([^${}]+)\}`)
+
+// ConfSetEnvPrefix see Conf.SetEnvPrefix, for default conf
+func ConfSetEnvPrefix(prefix string) {
+	confDefault().SetEnvPrefix(prefix)
+}
+
+// ConfSetArgs see Conf.SetArgs, for default conf
+func ConfSetArgs(args []string) {
+	confDefault().SetArgs(args)
+}
+
+// GetSource see Conf.GetSource, read from default conf
+func GetSource(section string, key string) string {
+	return confDefault().GetSource(section, key)
+}
+
+// SetEnvPrefix enable env var overrides like PREFIX_SECTION__KEY, empty prefix disable it
+func (c *Conf) SetEnvPrefix(prefix string) {
+	if c == nil {
+		return
+	}
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	c.envPrefix = strings.TrimSuffix(prefix, "_")
+	c.swap(c.overlay(c.fileContent))
+}
+
+// SetArgs set command line args for overrides, usually os.Args[1:],
+// only --section.key=value args are used, others are ignored
+func (c *Conf) SetArgs(args []string) {
+	if c == nil {
+		return
+	}
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	c.args = append([]string{}, args...)
+	c.swap(c.overlay(c.fileContent))
+}
+
+// GetSource get which source supplied the final value of key:
+// file path, env:NAME or flag:--section.key, empty when key not exists
+func (c *Conf) GetSource(section string, key string) string {
+	_, source, err := c.lookup(section, key)
+	if err != nil {
+		return ""
+	}
+	return source
+}
+
+//overlay apply env and flag overrides and interpolation on a copy of file content
+func (c *Conf) overlay(files *confContent) *confContent {
+	content := newConfContent()
+	if files != nil {
+		content.order = files.order
+		for section, keys := range files.cache {
+			content.addSection(section)
+			for key, value := range keys {
+				content.set(section, key, value, files.sources[section][key])
+			}
+		}
+	}
+
+	//env overrides
+	if c.envPrefix != "" {
+		prefix := c.envPrefix + "_"
+		for _, env := range os.Environ() {
+			pair := strings.SplitN(env, "=", 2)
+			if len(pair) != 2 || !strings.HasPrefix(pair[0], prefix) {
+				continue
+			}
+			names := strings.SplitN(strings.TrimPrefix(pair[0], prefix), "__", 2)
+			if len(names) != 2 || names[0] == "" || names[1] == "" {
+				continue
+			}
+			content.set(strings.ToLower(names[0]), strings.ToLower(names[1]), pair[1], "env:"+pair[0])
+		}
+	}
+
+	//flag overrides
+	for _, arg := range c.args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		pair := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		//section may contain dot, like server.tls, so split by the last one
+		pos := strings.LastIndex(pair[0], ".")
+		if pos < 1 || pos == len(pair[0])-1 {
+			continue
+		}
+		name := strings.ToLower(pair[0])
+		content.set(name[:pos], name[pos+1:], pair[1], "flag:--"+name)
+	}
+
+	content.interpolate()
+	return content
+}
+
+//interpolate replace ${ENV_VAR} and ${section.key} in string values
+func (c *confContent) interpolate() {
+	for _, keys := range c.cache {
+		for key, value := range keys {
+			str, ok := value.(string)
+			if !ok || !strings.Contains(str, "${") {
+				continue
+			}
+			keys[key] = c.expand(str, confInterpolateDepth)
+		}
+	}
+}
+
+func (c *confContent) expand(value string, depth int) string {
+	if depth <= 0 {
+		return value
+	}
+
+	return confRefReg.ReplaceAllStringFunc(value, func(ref string) string {
+		name := strings.TrimSpace(ref[2 : len(ref)-1])
+
+		pos := strings.LastIndex(name, ".")
+		if pos < 0 {
+			env, exists := os.LookupEnv(name)
+			if !exists {
+				return ref
+			}
+			return env
+		}
+
+		lower_name := strings.ToLower(name)
+		target, exists := c.cache[lower_name[:pos]][lower_name[pos+1:]]
+		if !exists {
+			return ref
+		}
+		str, err := toString(target)
+		if err != nil {
+			return ref
+		}
+		return c.expand(str, depth-1)
+	})
+}
@@ -0,0 +1,213 @@
+package larix
+
+/**
+ * conf parsers registry, every parser turns file content into
+ * section => key => value, section and key case are lowered when loading
+ *
+ * built-in parsers:
+ *	ini:        go-ini sections
+ *	yaml, yml:  see flattenConf
+ *	json:       see flattenConf
+ *	toml:       see flattenConf
+ **/
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	toml "github.com/BurntSushi/toml"
+	ini "github.com/go-ini/ini"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ConfParser parse config file content into sections
+type ConfParser func(data []byte) (LarixConf, error)
+
+// guard dialConf and confParsers
+var confParsersMu sync.RWMutex
+
+//file suffix => conf type
+var dialConf map[string]int = map[string]int{
+	"ini":  CONF_INI,
+	"yml":  CONF_YAML,
+	"yaml": CONF_YAML,
+	"json": CONF_JSON,
+	"toml": CONF_TOML,
+}
+
+//conf type => parser
+var confParsers map[int]ConfParser = map[int]ConfParser{
+	CONF_INI:  parseIni,
+	CONF_YAML: parseYaml,
+	CONF_JSON: parseJson,
+	CONF_TOML: parseToml,
+}
+
+//next conf type for RegisterConfParser
+var confTypeNext int = CONF_OVER
+
+// RegisterConfParser add a parser for file suffixes, like []string{"hcl"},
+// suffixes already registered are taken over by the new parser
+// return the conf type used as key in Conf.ConfigFiles
+func RegisterConfParser(suffixes []string, parser ConfParser) int {
+	if parser == nil || len(suffixes) == 0 {
+		return -1
+	}
+
+	confParsersMu.Lock()
+	defer confParsersMu.Unlock()
+
+	c_type := confTypeNext
+	confTypeNext++
+	confParsers[c_type] = parser
+	for _, suffix := range suffixes {
+		dialConf[strings.ToLower(strings.TrimPrefix(suffix, "."))] = c_type
+	}
+	return c_type
+}
+
+func confParserOf(c_type int) ConfParser {
+	confParsersMu.RLock()
+	defer confParsersMu.RUnlock()
+	return confParsers[c_type]
+}
+
+func parseIni(data []byte) (LarixConf, error) {
+	cfg, err := ini.Load(data)
+	if err != nil {
+		return nil, err
+	}
+
+	res := LarixConf{}
+	for _, section := range cfg.SectionStrings() {
+		keys := make(map[string]interface{})
+		for _, key := range cfg.Section(section).Keys() {
+			keys[key.Name()] = key.Value()
+		}
+		res[section] = keys
+	}
+	return res, nil
+}
+
+func parseYaml(data []byte) (LarixConf, error) {
+	values := map[string]interface{}{}
+	err := yaml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+	return flattenConf(values), nil
+}
+
+func parseJson(data []byte) (LarixConf, error) {
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	//keep integers as integers, not float64
+	decoder.UseNumber()
+	err := decoder.Decode(&values)
+	if err != nil {
+		return nil, err
+	}
+	return flattenConf(values), nil
+}
+
+func parseToml(data []byte) (LarixConf, error) {
+	values := map[string]interface{}{}
+	err := toml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+	return flattenConf(values), nil
+}
+
+// flattenConf turn nested values into sections: top-level mappings are sections,
+// top-level scalars and lists go to the ini default section; nested mappings
+// become sub sections named "section.sub", the same naming go-ini uses for child sections
+func flattenConf(values map[string]interface{}) LarixConf {
+	res := LarixConf{}
+	for key, value := range values {
+		if sub, ok := confMap(value); ok {
+			flattenSection(res, key, sub)
+			continue
+		}
+		setFlatValue(res, ini.DefaultSection, key, confValue(value))
+	}
+	return res
+}
+
+func flattenSection(res LarixConf, section string, values map[string]interface{}) {
+	//keep empty sections visible in GetSectionsKeys
+	if _, exists := res[section]; !exists {
+		res[section] = make(map[string]interface{})
+	}
+
+	for key, value := range values {
+		if sub, ok := confMap(value); ok {
+			flattenSection(res, section+"."+key, sub)
+			continue
+		}
+		setFlatValue(res, section, key, confValue(value))
+	}
+}
+
+func setFlatValue(res LarixConf, section string, key string, value interface{}) {
+	if _, exists := res[section]; !exists {
+		res[section] = make(map[string]interface{})
+	}
+	res[section][key] = value
+}
+
+//confMap check if value is a mapping, and convert it to string keys
+func confMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			res[fmt.Sprintf("%v", k)] = v
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+//confValue keep scalars and lists, maps inside lists are converted to string keys
+func confValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = confValue(item)
+		}
+		return res
+
+	case []map[string]interface{}:
+		//toml array of tables
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = confValue(item)
+		}
+		return res
+
+	case json.Number:
+		if res, err := v.Int64(); err == nil {
+			return res
+		}
+		if res, err := v.Float64(); err == nil {
+			return res
+		}
+		return v.String()
+	}
+
+	if m, ok := confMap(value); ok {
+		res := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			res[k] = confValue(v)
+		}
+		return res
+	}
+
+	return value
+}
@@ -0,0 +1,218 @@
+package larix
+
+/**
+ * conf hot reload: re-parse config files, swap the cache and notify
+ * subscribers with the keys changed in every section
+ **/
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ConfDiff keys changed in one section after reload
+type ConfDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// ConfSubscriber called after reload with section => diff,
+// sections without change are not in the map
+type ConfSubscriber func(diff map[string]*ConfDiff)
+
+// ConfSubscribe see Conf.Subscribe, for default conf
+func ConfSubscribe(fn ConfSubscriber) {
+	confDefault().Subscribe(fn)
+}
+
+// ConfReload see Conf.Reload, for default conf
+func ConfReload() error {
+	return confDefault().Reload()
+}
+
+// ConfWatch see Conf.Watch, for default conf
+func ConfWatch(interval time.Duration, onError func(err error)) (stop func()) {
+	return confDefault().Watch(interval, onError)
+}
+
+// Subscribe register a callback notified after every successful reload
+func (c *Conf) Subscribe(fn ConfSubscriber) {
+	if c == nil || fn == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, fn)
+}
+
+// Reload re-parse config files and swap the conf cache,
+// if any file failed to parse, or a file loaded before is missing, previous conf
+// is kept and error returned; optional files with "?" prefix may go away
+func (c *Conf) Reload() error {
+	if c == nil {
+		return errors.New("conf not init")
+	}
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	content, errs := c.parseFiles()
+	if err := confErrors(errs, c.strict, c.fileContent.order); err != nil {
+		return fmt.Errorf("reload conf failed, keep previous conf: %w", err)
+	}
+
+	c.fileContent = content
+	c.swap(c.overlay(content))
+	return nil
+}
+
+//swap in new conf content and notify subscribers, caller hold reloadMu
+func (c *Conf) swap(content *confContent) {
+	c.mu.Lock()
+	diff := diffConf(c.ConfigCache, content.cache)
+	c.setContent(content)
+	subscribers := append([]ConfSubscriber{}, c.subscribers...)
+	c.mu.Unlock()
+
+	if len(diff) == 0 {
+		return
+	}
+	for _, fn := range subscribers {
+		fn(diff)
+	}
+}
+
+// Watch reload conf when config files modified or SIGHUP received,
+// files are checked every interval, reload errors are passed to onError,
+// write to stderr when onError is nil
+// call the returned func to stop watching
+func (c *Conf) Watch(interval time.Duration, onError func(err error)) (stop func()) {
+	if c == nil {
+		return func() {}
+	}
+
+	if onError == nil {
+		onError = func(err error) {
+			os.Stderr.WriteString(err.Error() + "\n")
+		}
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer signal.Stop(sighup)
+
+		last := confFilesStat(c.watchPaths())
+		for {
+			select {
+			case <-done:
+				return
+			case <-sighup:
+			case <-ticker.C:
+				curr := confFilesStat(c.watchPaths())
+				if reflect.DeepEqual(last, curr) {
+					continue
+				}
+			}
+
+			//stat before reload, so changes during reload are picked up next time
+			last = confFilesStat(c.watchPaths())
+			if err := c.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
+//watchPaths loaded files, and config paths so new files in directory
+//and created optional files are found
+func (c *Conf) watchPaths() []string {
+	res := c.LoadOrder()
+	for _, config := range c.configs {
+		path := strings.TrimPrefix(config, "?")
+		if strings.ContainsAny(path, "*?[") {
+			path = filepath.Dir(path)
+		}
+		res = append(res, path)
+	}
+	return res
+}
+
+//confFilesStat modify time and size of files, missing files are absent
+func confFilesStat(files []string) map[string]string {
+	res := make(map[string]string, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		res[file] = fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+	}
+	return res
+}
+
+//diffConf compare two conf caches section by section
+func diffConf(prev LarixConf, curr LarixConf) map[string]*ConfDiff {
+	res := make(map[string]*ConfDiff)
+
+	for section, keys := range curr {
+		diff := &ConfDiff{}
+		prev_keys := prev[section]
+		for key, value := range keys {
+			prev_value, exists := prev_keys[key]
+			if !exists {
+				diff.Added = append(diff.Added, key)
+			} else if !reflect.DeepEqual(prev_value, value) {
+				diff.Changed = append(diff.Changed, key)
+			}
+		}
+		for key := range prev_keys {
+			if _, exists := keys[key]; !exists {
+				diff.Removed = append(diff.Removed, key)
+			}
+		}
+		if len(diff.Added)+len(diff.Removed)+len(diff.Changed) > 0 {
+			res[section] = diff.sorted()
+		}
+	}
+
+	for section, keys := range prev {
+		if _, exists := curr[section]; exists || len(keys) == 0 {
+			continue
+		}
+		diff := &ConfDiff{}
+		for key := range keys {
+			diff.Removed = append(diff.Removed, key)
+		}
+		res[section] = diff.sorted()
+	}
+
+	return res
+}
+
+func (d *ConfDiff) sorted() *ConfDiff {
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
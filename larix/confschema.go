@@ -0,0 +1,283 @@
+package larix
+
+/**
+ * conf schema validation and dump
+ *
+ * schema is section => key => rule, rule is comma separated like struct tags:
+ *
+ *	schema := larix.ConfSchema{
+ *		"server": {
+ *			"host":    "string,required",
+ *			"port":    "int,required,min=1,max=65535",
+ *			"mode":    "string,in=debug|release",
+ *			"timeout": "duration,max=30s",
+ *		},
+ *	}
+ *
+ * types: string, int, float, bool, duration, list, empty for any type
+ * min/max limit number and duration values, and length of string and list
+ **/
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ini "github.com/go-ini/ini"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ConfSchema section => key => rule
+type ConfSchema map[string]map[string]string
+
+// mask of secret values in dump
+const confSecretMask = "******"
+
+//keys look like secrets, their values are masked in dump
+var confSecretReg = regexp.MustCompile(`(?i)(passw|secret|token|credential|private_?key|api_?key)`)
+
+// ConfValidate see Conf.Validate, for default conf
+func ConfValidate(schema ConfSchema) error {
+	return confDefault().Validate(schema)
+}
+
+// ConfDump see Conf.Dump, for default conf
+func ConfDump(w io.Writer, format string) error {
+	return confDefault().Dump(w, format)
+}
+
+// Validate check conf against schema, all violations are returned in one error
+func (c *Conf) Validate(schema ConfSchema) error {
+	errs := []error{}
+
+	sections := make([]string, 0, len(schema))
+	for section := range schema {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	for _, section := range sections {
+		keys := make([]string, 0, len(schema[section]))
+		for key := range schema[section] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			err := c.validateKey(section, key, schema[section][key])
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Conf) validateKey(section string, key string, rule string) error {
+	r_type := ""
+	required := false
+	allowed := []string{}
+	var min, max string
+
+	for _, item := range strings.Split(rule, ",") {
+		item = strings.TrimSpace(item)
+		pair := strings.SplitN(item, "=", 2)
+		switch {
+		case item == "":
+		case item == "required":
+			required = true
+		case len(pair) == 2 && pair[0] == "in":
+			allowed = strings.Split(pair[1], "|")
+		case len(pair) == 2 && pair[0] == "min":
+			min = pair[1]
+		case len(pair) == 2 && pair[0] == "max":
+			max = pair[1]
+		case len(pair) == 1 && r_type == "":
+			r_type = item
+		default:
+			return fmt.Errorf("conf section [%s] key [%s] schema rule [%s] invalid", section, key, item)
+		}
+	}
+
+	value, file, err := c.lookup(section, key)
+	if err != nil {
+		if required {
+			return fmt.Errorf("conf section [%s] key [%s] is required", strings.ToLower(section), strings.ToLower(key))
+		}
+		return nil
+	}
+
+	//size compared with min and max
+	var size float64
+	switch r_type {
+	case "", "string":
+		str, err := toString(value)
+		if err != nil {
+			if r_type == "" {
+				break
+			}
+			return confValueError(section, key, file, err)
+		}
+		size = float64(len(str))
+	case "int":
+		res, err := toInt(value)
+		if err != nil {
+			return confValueError(section, key, file, err)
+		}
+		size = float64(res)
+	case "float":
+		str, _ := toString(value)
+		res, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil {
+			return confValueError(section, key, file, fmt.Errorf("value [%v] is not a float", value))
+		}
+		size = res
+	case "bool":
+		if _, err := toBool(value); err != nil {
+			return confValueError(section, key, file, err)
+		}
+	case "duration":
+		res, err := toDuration(value)
+		if err != nil {
+			return confValueError(section, key, file, err)
+		}
+		size = float64(res)
+	case "list":
+		res, err := toStringSlice(value)
+		if err != nil {
+			return confValueError(section, key, file, err)
+		}
+		size = float64(len(res))
+	default:
+		return fmt.Errorf("conf section [%s] key [%s] schema type [%s] not support", section, key, r_type)
+	}
+
+	if len(allowed) > 0 {
+		str, _ := toString(value)
+		in := false
+		for _, item := range allowed {
+			if item == str {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return confValueError(section, key, file, fmt.Errorf("value [%v] not in [%s]", value, strings.Join(allowed, "|")))
+		}
+	}
+
+	for _, limit := range []struct {
+		name  string
+		value string
+	}{{"min", min}, {"max", max}} {
+		if limit.value == "" {
+			continue
+		}
+		bound, err := schemaBound(r_type, limit.value)
+		if err != nil {
+			return fmt.Errorf("conf section [%s] key [%s] schema %s [%s] invalid", section, key, limit.name, limit.value)
+		}
+		if (limit.name == "min" && size < bound) || (limit.name == "max" && size > bound) {
+			return confValueError(section, key, file, fmt.Errorf("value [%v] out of range, %s is %s", value, limit.name, limit.value))
+		}
+	}
+
+	return nil
+}
+
+//schemaBound parse min and max by type, duration like "30s"
+func schemaBound(r_type string, bound string) (float64, error) {
+	if r_type == "duration" {
+		res, err := time.ParseDuration(bound)
+		return float64(res), err
+	}
+	return strconv.ParseFloat(bound, 64)
+}
+
+// Dump write the effective conf in format ini, yaml or json,
+// values of secret-looking keys like passwd are masked
+func (c *Conf) Dump(w io.Writer, format string) error {
+	dump := LarixConf{}
+	if c != nil {
+		c.mu.RLock()
+		for section, keys := range c.ConfigCache {
+			dump[section] = make(map[string]interface{}, len(keys))
+			for key, value := range keys {
+				if confSecretReg.MatchString(key) {
+					value = confSecretMask
+				}
+				dump[section][key] = value
+			}
+		}
+		c.mu.RUnlock()
+	}
+
+	switch strings.ToLower(format) {
+	case "ini":
+		return dumpIni(w, dump)
+	case "yaml", "yml":
+		data, err := yaml.Marshal(dump)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "json":
+		data, err := json.MarshalIndent(dump, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+
+	return fmt.Errorf("dump format [%s] not support", format)
+}
+
+//dumpIni write sections in order, default section first without header
+func dumpIni(w io.Writer, dump LarixConf) error {
+	default_section := strings.ToLower(ini.DefaultSection)
+	sections := []string{}
+	for section := range dump {
+		if section != default_section {
+			sections = append(sections, section)
+		}
+	}
+	sort.Strings(sections)
+	if _, exists := dump[default_section]; exists {
+		sections = append([]string{default_section}, sections...)
+	}
+
+	var res strings.Builder
+	for _, section := range sections {
+		if section != default_section {
+			res.WriteString("[" + section + "]\n")
+		}
+
+		keys := make([]string, 0, len(dump[section]))
+		for key := range dump[section] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := dump[section][key]
+			str, err := toString(value)
+			if err != nil {
+				list, _ := toStringSlice(value)
+				str = strings.Join(list, ",")
+			}
+			res.WriteString(key + " = " + str + "\n")
+		}
+		res.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, res.String())
+	return err
+}
@@ -0,0 +1,322 @@
+package larix
+
+/**
+ * typed accessors for conf cache values
+ * ini values are always strings, yaml values keep their own type,
+ * so every getter accepts both
+ **/
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//lookup a key in conf cache, section and key are case insensitive
+func (c *Conf) lookup(section string, key string) (interface{}, string, error) {
+	lower_section := strings.ToLower(section)
+	lower_key := strings.ToLower(key)
+
+	if c == nil {
+		return nil, "", fmt.Errorf("conf section [%s] key [%s] not found: conf not init", lower_section, lower_key)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys, exists := c.ConfigCache[lower_section]
+	if !exists {
+		return nil, "", fmt.Errorf("conf section [%s] not found", lower_section)
+	}
+
+	value, exists := keys[lower_key]
+	if !exists {
+		return nil, "", fmt.Errorf("conf section [%s] key [%s] not found", lower_section, lower_key)
+	}
+
+	return value, c.sources[lower_section][lower_key], nil
+}
+
+//confValueError name the section, key and source of a bad value
+func confValueError(section string, key string, file string, err error) error {
+	return fmt.Errorf("conf section [%s] key [%s] from [%s] invalid: %s",
+		strings.ToLower(section), strings.ToLower(key), file, err.Error())
+}
+
+// MustString get a string value, error when key not exists
+func (c *Conf) MustString(section string, key string) (string, error) {
+	value, file, err := c.lookup(section, key)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := toString(value)
+	if err != nil {
+		return "", confValueError(section, key, file, err)
+	}
+	return res, nil
+}
+
+// MustInt get an int value, error when key not exists or not an integer
+func (c *Conf) MustInt(section string, key string) (int, error) {
+	value, file, err := c.lookup(section, key)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := toInt(value)
+	if err != nil {
+		return 0, confValueError(section, key, file, err)
+	}
+	return res, nil
+}
+
+// MustBool get a bool value, error when key not exists or not a bool
+func (c *Conf) MustBool(section string, key string) (bool, error) {
+	value, file, err := c.lookup(section, key)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := toBool(value)
+	if err != nil {
+		return false, confValueError(section, key, file, err)
+	}
+	return res, nil
+}
+
+// MustDuration get a time.Duration value, error when key not exists or not a duration
+func (c *Conf) MustDuration(section string, key string) (time.Duration, error) {
+	value, file, err := c.lookup(section, key)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := toDuration(value)
+	if err != nil {
+		return 0, confValueError(section, key, file, err)
+	}
+	return res, nil
+}
+
+// MustStringSlice get a string list value, error when key not exists
+func (c *Conf) MustStringSlice(section string, key string) ([]string, error) {
+	value, file, err := c.lookup(section, key)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := toStringSlice(value)
+	if err != nil {
+		return nil, confValueError(section, key, file, err)
+	}
+	return res, nil
+}
+
+// GetString get a string value, return def when key not exists or invalid
+func (c *Conf) GetString(section string, key string, def string) string {
+	res, err := c.MustString(section, key)
+	if err != nil {
+		return def
+	}
+	return res
+}
+
+// GetInt get an int value, return def when key not exists or invalid
+func (c *Conf) GetInt(section string, key string, def int) int {
+	res, err := c.MustInt(section, key)
+	if err != nil {
+		return def
+	}
+	return res
+}
+
+// GetBool get a bool value, return def when key not exists or invalid
+func (c *Conf) GetBool(section string, key string, def bool) bool {
+	res, err := c.MustBool(section, key)
+	if err != nil {
+		return def
+	}
+	return res
+}
+
+// GetDuration get a time.Duration value, return def when key not exists or invalid
+func (c *Conf) GetDuration(section string, key string, def time.Duration) time.Duration {
+	res, err := c.MustDuration(section, key)
+	if err != nil {
+		return def
+	}
+	return res
+}
+
+// GetStringSlice get a string list value, return def when key not exists or invalid
+func (c *Conf) GetStringSlice(section string, key string, def []string) []string {
+	res, err := c.MustStringSlice(section, key)
+	if err != nil {
+		return def
+	}
+	return res
+}
+
+// MustString see Conf.MustString, read from default conf
+func MustString(section string, key string) (string, error) {
+	return confDefault().MustString(section, key)
+}
+
+// MustInt see Conf.MustInt, read from default conf
+func MustInt(section string, key string) (int, error) {
+	return confDefault().MustInt(section, key)
+}
+
+// MustBool see Conf.MustBool, read from default conf
+func MustBool(section string, key string) (bool, error) {
+	return confDefault().MustBool(section, key)
+}
+
+// MustDuration see Conf.MustDuration, read from default conf
+func MustDuration(section string, key string) (time.Duration, error) {
+	return confDefault().MustDuration(section, key)
+}
+
+// MustStringSlice see Conf.MustStringSlice, read from default conf
+func MustStringSlice(section string, key string) ([]string, error) {
+	return confDefault().MustStringSlice(section, key)
+}
+
+// GetString see Conf.GetString, read from default conf
+func GetString(section string, key string, def string) string {
+	return confDefault().GetString(section, key, def)
+}
+
+// GetInt see Conf.GetInt, read from default conf
+func GetInt(section string, key string, def int) int {
+	return confDefault().GetInt(section, key, def)
+}
+
+// GetBool see Conf.GetBool, read from default conf
+func GetBool(section string, key string, def bool) bool {
+	return confDefault().GetBool(section, key, def)
+}
+
+// GetDuration see Conf.GetDuration, read from default conf
+func GetDuration(section string, key string, def time.Duration) time.Duration {
+	return confDefault().GetDuration(section, key, def)
+}
+
+// GetStringSlice see Conf.GetStringSlice, read from default conf
+func GetStringSlice(section string, key string, def []string) []string {
+	return confDefault().GetStringSlice(section, key, def)
+}
+
+func toString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []interface{}, map[string]interface{}:
+		return "", fmt.Errorf("value [%v] is not a scalar", v)
+	case nil:
+		return "", nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+func toInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		if v < math.MinInt || v > math.MaxInt {
+			return 0, fmt.Errorf("value [%v] out of int range", v)
+		}
+		return int(v), nil
+	case uint64:
+		if v > math.MaxInt {
+			return 0, fmt.Errorf("value [%v] out of int range", v)
+		}
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("value [%v] is not an integer", v)
+		}
+		//-MinInt is 2^63 exactly in float, MaxInt is not
+		if v < math.MinInt || v >= -math.MinInt {
+			return 0, fmt.Errorf("value [%v] out of int range", v)
+		}
+		return int(v), nil
+	case string:
+		res, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("value [%s] is not an integer", v)
+		}
+		return res, nil
+	}
+	return 0, fmt.Errorf("value [%v] is not an integer", value)
+}
+
+func toBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		//same words as go-ini accept
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "1", "t", "true", "y", "yes", "on":
+			return true, nil
+		case "0", "f", "false", "n", "no", "off":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("value [%v] is not a bool", value)
+}
+
+//numbers without unit are taken as seconds
+func toDuration(value interface{}) (time.Duration, error) {
+	if s, ok := value.(string); ok {
+		s = strings.TrimSpace(s)
+		if res, err := time.ParseDuration(s); err == nil {
+			return res, nil
+		}
+		value = s
+	}
+
+	sec, err := toInt(value)
+	if err != nil {
+		return 0, fmt.Errorf("value [%v] is not a duration", value)
+	}
+	return time.Duration(sec) * time.Second, nil
+}
+
+//strings are split by comma, yaml lists are kept
+func toStringSlice(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			str, err := toString(item)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, str)
+		}
+		return res, nil
+	case []string:
+		return v, nil
+	case string:
+		res := []string{}
+		for _, item := range strings.Split(v, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			res = append(res, item)
+		}
+		return res, nil
+	}
+
+	str, err := toString(value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{str}, nil
+}
@@ -19,6 +19,8 @@ type HttpClient struct {
 	// redirects, and reading the response body
 	Timeout_ms int64
 	Host       string
+	// log of request failures, nil for default log
+	Log *Log
 }
 
 //simple check if status OK
@@ -63,7 +65,7 @@ func (hc *HttpClient) Request(method string, uri string, body io.Reader) ([]byte
 			"url":     url,
 			"err_msg": err.Error(),
 		}
-		LogWarn(log_info)
+		hc.Log.Warn(log_info)
 		return []byte{}, err
 	}
 	defer resp.Body.Close()
@@ -75,7 +77,7 @@ func (hc *HttpClient) Request(method string, uri string, body io.Reader) ([]byte
 			"headers":   fmt.Sprintf("%v", resp.Header),
 			"url":       url,
 		}
-		LogWarn(log_info)
+		hc.Log.Warn(log_info)
 		return []byte{}, errors.New(fmt.Sprintf("http status is %d", resp.StatusCode))
 	}
 
@@ -90,7 +92,7 @@ func (hc *HttpClient) Request(method string, uri string, body io.Reader) ([]byte
 			"error":     err.Error(),
 			"url":       url,
 		}
-		LogWarn(log_info)
+		hc.Log.Warn(log_info)
 		return []byte{}, err
 	}
 
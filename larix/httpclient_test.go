@@ -0,0 +1,63 @@
+package larix_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kstrwind/lib-go/larix"
+	"github.com/kstrwind/lib-go/larix/logtest"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *larix.HttpClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port_num, _ := strconv.Atoi(port)
+	return &larix.HttpClient{Ip: host, Port: port_num, Timeout_ms: 1000}
+}
+
+func Test_HttpClientRequest(t *testing.T) {
+	logs := logtest.Install(t)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.URL.Path))
+	})
+
+	res, err := client.Request("post", "/api", nil)
+	if err != nil || string(res) != "POST /api" {
+		t.Errorf("Request got %q, %v", res, err)
+	}
+	if entries := logs.Entries(); len(entries) != 0 {
+		t.Errorf("success request should not log, got %v", entries)
+	}
+}
+
+func Test_HttpClientRequestFailed(t *testing.T) {
+	logs := logtest.Install(t)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	if _, err := client.Request("GET", "/api", nil); err == nil {
+		t.Error("Request should fail by status 500")
+	}
+	if logs.AssertLogged(t, larix.LOG_WARN, "http request status wrong") {
+		entry := logs.Find(larix.LOG_WARN, "http request status wrong")[0]
+		if fmt.Sprint(entry.Fields["http_code"]) != "500" || entry.Caller == "" {
+			t.Errorf("log entry = %s", entry)
+		}
+	}
+
+	//own log of client
+	own := logtest.New()
+	defer own.Log.Close()
+	client.Log = own.Log
+	client.Port = 1
+	client.Request("GET", "/api", nil)
+	own.AssertLogged(t, larix.LOG_WARN, "http request failed")
+	logs.AssertNotLogged(t, larix.LOG_WARN, "http request failed")
+}
@@ -6,9 +6,14 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,20 +24,99 @@ type Log struct {
 	//error file , default
 	errorFile string
 
-	// if log rotate, current support for hour
+	// if log rotate, by hour, day or size, see logrotate.go
 	Rotate bool
 
+	// rotate policy, hour, day or size
+	RotateBy string
+
+	// max bytes of a log file when rotate by size
+	MaxSize int64
+
+	// rotated files to keep, 0 for all
+	MaxBackups int
+
+	// max age of rotated files to keep, 0 for forever
+	MaxAge time.Duration
+
+	// gzip rotated files
+	Compress bool
+
+	// keep File and File.wf as symlinks to current files when rotate
+	Symlink bool
+
+	// permission of created log files and dirs, umask not applied
+	FileMode os.FileMode
+	DirMode  os.FileMode
+
+	// owner of created log files and dirs like "user:group", empty for unchanged
+	Owner string
+
+	// uid and gid of Owner, -1 for unchanged
+	uid int
+	gid int
+
+	// write by a background goroutine, see logasync.go
+	Async bool
+
+	// max lines in async buffer
+	BufferSize int
+
+	// async buffer overflow policy, block, drop or droplow
+	Overflow string
+
+	// max time to wait for async buffer drained by flush
+	FlushTimeout time.Duration
+
 	// basic fields, will out in every log
+	// change by LogAddBasic and LogRmBasic, they are guarded by basicMu
 	BasicFields map[string]interface{}
 
-	//log level
-	Level int
+	// guard BasicFields
+	basicMu sync.RWMutex
+
+	//log level, see loglevel.go
+	level int32
+
+	//lowest level of log and modules, lines below are dropped at once
+	minLevel int32
+
+	//module levels by package prefix, map[string]int, copy on write
+	modules atomic.Value
+
+	// serialize level changes
+	moduleMu sync.Mutex
+
+	//log line format, text or json
+	Format string
 
 	//current rotate sign, we use year montn day hour
 	CurrRotateSign int
 
-	// ensure atomic log handler update
-	mu sync.Mutex
+	//suffix of current log files, empty when not rotate
+	currSuffix string
+
+	//no rotate before, set when rotate failed
+	rotateRetry time.Time
+
+	//bytes written to current files, for rotate by size
+	nsize int64
+	wsize int64
+
+	// guard log handlers, writers hold read lock, rotate holds write lock
+	mu sync.RWMutex
+
+	// one cleanup of rotated files at a time
+	cleanupMu sync.Mutex
+
+	// cleanups running in background, waited by Close
+	cleanupWg sync.WaitGroup
+
+	// close only once
+	closeOnce sync.Once
+
+	// set by Close, no write or rotate after it, guarded by mu
+	closed bool
 
 	// normal log file handler
 	nfd *os.File
@@ -45,6 +129,35 @@ type Log struct {
 
 	// wrong log Handler
 	wlog *log.Logger
+
+	// async writer, nil when write in caller goroutine
+	async *logAsync
+
+	// sampling, lines logged every second by key, see logsample.go
+	SampleFirst      int
+	SampleThereafter int
+
+	// sample key, caller or message
+	SampleBy string
+
+	// interval of suppressed lines report
+	SampleReport time.Duration
+
+	// nil when not sampling
+	sampler *logSampler
+
+	// add caller function name, see logcaller.go
+	CallerFunc bool
+
+	// lines at or above level carry stack, LOG_OVER for none
+	StackLevel int
+
+	// sinks by level, guarded by mu, see logsink.go
+	routes []*logRoute
+
+	// reopen files on signal, guarded by reopenMu, see logreopen.go
+	reopen   *logReopen
+	reopenMu sync.Mutex
 }
 
 //control fields
@@ -59,17 +172,73 @@ type Log struct {
 		"level": 0,
 	}
 */
-// conf define for ini conf to map
-// now not use
+// conf define for ini conf to map, can be filled by UnmarshalSection:
+/*
+	var conf larix.LogConf
+	err := larix.UnmarshalSection("log", &conf)
+	if err == nil {
+		err = larix.LogInit(&conf)
+	}
+*/
 type LogConf struct {
 	File   string `ini:"file"`
 	Rotate bool   `ini:"rotate"`
-	Level  int    `ini:"level"`
+	Level  int    `ini:"-"`
+	Format string `ini:"format"`
+	//level name like "warning" or number, overrides Level when set
+	LevelName string `ini:"level"`
+	//basic fields like "service:order,version:1.0.2", same as LogAddBasic
+	Basic string `ini:"basic"`
+
+	//rotate policy, see Log
+	RotateBy   string        `ini:"rotate_by"`
+	MaxSize    int64         `ini:"max_size"`
+	MaxBackups int           `ini:"max_backups"`
+	MaxAge     time.Duration `ini:"max_age"`
+	Compress   bool          `ini:"compress"`
+	Symlink    bool          `ini:"symlink"`
+
+	//octal permission like "0640" and owner like "user:group" of created files and dirs,
+	//see logrotate.go
+	FileMode string `ini:"file_mode"`
+	DirMode  string `ini:"dir_mode"`
+	Owner    string `ini:"owner"`
+
+	//reopen files on SIGUSR1 when moved by external logrotate, see logreopen.go
+	ReopenOnSignal bool `ini:"reopen_on_signal"`
+
+	//async writer, see logasync.go
+	Async        bool          `ini:"async"`
+	BufferSize   int           `ini:"buffer_size"`
+	Overflow     string        `ini:"overflow"`
+	FlushTimeout time.Duration `ini:"flush_timeout"`
+
+	//sampling, see logsample.go
+	SampleFirst      int           `ini:"sample_first"`
+	SampleThereafter int           `ini:"sample_thereafter"`
+	SampleBy         string        `ini:"sample_by"`
+	SampleReport     time.Duration `ini:"sample_report"`
+
+	//caller function and stack level name, empty for no stack, see logcaller.go
+	CallerFunc bool   `ini:"caller_func"`
+	StackLevel string `ini:"stack_level"`
+
+	//module levels like "sdk/zabbix:debug, main:warning", see loglevel.go
+	Modules string `ini:"modules"`
+
+	//more sinks like "stderr, tcp://127.0.0.1:5140?level=warning", see logsink.go
+	Sinks string `ini:"sinks"`
 }
 
+//log format
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
 //log level
 const (
-	LOG_DEBUG int = iota
+	LOG_DEBUG = iota
 	LOG_TRACE
 	LOG_NOTICE
 	LOG_WARN
@@ -87,148 +256,352 @@ var logString map[int]string = map[int]string{
 
 //log level string
 
-//Log handler
-var logHdr *Log = nil
+//default log of package functions, *Log
+var logStd atomic.Value
 
+// LogInit init default log by conf, see NewLog,
+// init again replaces default log, and the old one is closed
 func LogInit(conf *LogConf) error {
-	if logHdr != nil {
-		LogFatal("re init log handler, invalid")
-		return nil
+	l, err := NewLog(conf)
+	if err != nil {
+		return err
 	}
 
-	logHdr = &Log{}
-
-	if conf.File == "" {
-		panic("log file path not found, please set by file field\n")
+	if old := LogSetDefault(l); old != nil {
+		old.Close()
 	}
-	logHdr.File = conf.File
+	return nil
+}
+
+// LogSetDefault replace default log used by package functions like LogNotice,
+// the old one is returned and not closed, nil to disable default log
+func LogSetDefault(l *Log) *Log {
+	old, _ := logStd.Swap(l).(*Log)
+	return old
+}
+
+// LogDefault get default log, nil before LogInit
+func LogDefault() *Log {
+	return logDefault()
+}
 
-	logHdr.Rotate = conf.Rotate
-	logHdr.Level = conf.Level
-	if logHdr.Level >= LOG_OVER || logHdr.Level < LOG_DEBUG {
+func logDefault() *Log {
+	l, _ := logStd.Load().(*Log)
+	return l
+}
+
+// NewLog create a log by conf, logs are independent with their own files,
+// level and rotation, invalid values are set to default with a message in stdout,
+// error is returned when files or sinks can't be opened
+func NewLog(conf *LogConf) (*Log, error) {
+	l := &Log{}
+
+	//without file, lines go to sinks or stdout
+	l.File = conf.File
+
+	l.Rotate = conf.Rotate && conf.File != ""
+	level := conf.Level
+	if conf.LevelName != "" {
+		//invalid name fails SetLevel below
+		level = -1
+		if parsed, err := ParseLogLevel(conf.LevelName); err == nil {
+			level = parsed
+		}
+	}
+	if l.SetLevel(level) != nil {
 		io.WriteString(os.Stdout, "log level invalid, we set to debug\n")
-		logHdr.Level = LOG_DEBUG
+		l.SetLevel(LOG_DEBUG)
+	}
+	modules, err := parseModuleLevels(conf.Modules)
+	if err != nil {
+		io.WriteString(os.Stdout, err.Error()+", we skip module levels\n")
+	}
+	for module, level := range modules {
+		l.SetModuleLevel(module, level)
 	}
 
-	//todo: basic fields support
-	var nlfile string
-	var wlfile string
+	l.CallerFunc = conf.CallerFunc
+	l.StackLevel = LOG_OVER
+	if conf.StackLevel != "" {
+		level, err := ParseLogLevel(conf.StackLevel)
+		if err != nil {
+			io.WriteString(os.Stdout, "log stack level invalid, we set to none\n")
+		} else {
+			l.StackLevel = level
+		}
+	}
 
-	if logHdr.Rotate {
-		logHdr.CurrRotateSign = getRotateSign()
-		nlfile = fmt.Sprintf("%s.%d", logHdr.File, logHdr.CurrRotateSign)
-		wlfile = fmt.Sprintf("%s.wf.%d", logHdr.File, logHdr.CurrRotateSign)
-	} else {
-		logHdr.CurrRotateSign = 0
-		nlfile = logHdr.File
-		wlfile = fmt.Sprintf("%s.wf", logHdr.File)
+	l.Format = strings.ToLower(conf.Format)
+	if l.Format == "" {
+		l.Format = LOG_FORMAT_TEXT
+	}
+	if l.Format != LOG_FORMAT_TEXT && l.Format != LOG_FORMAT_JSON {
+		io.WriteString(os.Stdout, "log format invalid, we set to text\n")
+		l.Format = LOG_FORMAT_TEXT
 	}
 
-	//open file and add log handler
-	var errf error
-	logHdr.nfd, errf = os.OpenFile(nlfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.ModeSetuid|os.ModeSetgid|0660)
-	if errf != nil {
-		panic(fmt.Sprintf("open log file %s failed, %s\n", nlfile, errf.Error()))
+	l.BasicFields = make(map[string]interface{})
+	if conf.Basic != "" {
+		for _, field := range strings.Split(conf.Basic, ",") {
+			pair := strings.SplitN(field, ":", 2)
+			key := strings.TrimSpace(pair[0])
+			if len(pair) != 2 || key == "" {
+				continue
+			}
+			l.BasicFields[key] = strings.TrimSpace(pair[1])
+		}
 	}
 
-	logHdr.wfd, errf = os.OpenFile(wlfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.ModeSetuid|os.ModeSetgid|0660)
-	if errf != nil {
-		logHdr.nfd.Close()
-		panic(fmt.Sprintf("open wflog file %s failed, %s\n", wlfile, errf.Error()))
+	l.RotateBy = strings.ToLower(conf.RotateBy)
+	if l.RotateBy == "" {
+		l.RotateBy = LOG_ROTATE_HOUR
+	}
+	if l.RotateBy != LOG_ROTATE_HOUR && l.RotateBy != LOG_ROTATE_DAY && l.RotateBy != LOG_ROTATE_SIZE {
+		io.WriteString(os.Stdout, "log rotate policy invalid, we set to hour\n")
+		l.RotateBy = LOG_ROTATE_HOUR
+	}
+	l.MaxSize = conf.MaxSize
+	if l.RotateBy == LOG_ROTATE_SIZE && l.MaxSize <= 0 {
+		io.WriteString(os.Stdout, "log max size not set, we set to 100MB\n")
+		l.MaxSize = 100 << 20
+	}
+	l.MaxBackups = conf.MaxBackups
+	l.MaxAge = conf.MaxAge
+	l.Compress = conf.Compress
+	l.Symlink = conf.Symlink
+
+	l.FileMode = logFileMode
+	if conf.FileMode != "" {
+		mode, err := parseLogMode(conf.FileMode)
+		if err != nil {
+			io.WriteString(os.Stdout, "log file mode invalid, we set to 0640\n")
+		} else {
+			l.FileMode = mode
+		}
+	}
+	l.DirMode = logDirMode
+	if conf.DirMode != "" {
+		mode, err := parseLogMode(conf.DirMode)
+		if err != nil {
+			io.WriteString(os.Stdout, "log dir mode invalid, we set to 0755\n")
+		} else {
+			l.DirMode = mode
+		}
+	}
+	l.uid, l.gid = -1, -1
+	if conf.Owner != "" {
+		l.uid, l.gid, err = parseLogOwner(conf.Owner)
+		if err != nil {
+			return nil, err
+		}
+		l.Owner = conf.Owner
 	}
 
-	// normal Log Handler
-	logHdr.nlog = log.New(logHdr.nfd, "", log.Ldate|log.Ltime|log.Lshortfile)
+	//network sinks start writer goroutines, they are closed when anything fails later
+	routes := []*logRoute{}
+	closeRoutes := func() {
+		for _, route := range routes {
+			route.sink.Close()
+		}
+	}
+	for _, spec := range strings.Split(conf.Sinks, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		route, err := openLogSink(strings.TrimSpace(spec))
+		if err != nil {
+			closeRoutes()
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
 
-	// wrong log Handler
-	logHdr.wlog = log.New(logHdr.wfd, "", log.Ldate|log.Ltime|log.Lshortfile)
-	return nil
-}
+	//open file and add log handler
+	if l.File != "" {
+		suffix := ""
+		l.CurrRotateSign = 0
+		if l.Rotate {
+			now := logNow()
+			l.CurrRotateSign = l.rotateSign(now)
+			suffix = l.nextSuffix(now)
+		}
+		nfd, wfd, err := l.openFiles(suffix)
+		if err != nil {
+			closeRoutes()
+			return nil, err
+		}
+		l.swapFiles(suffix, nfd, wfd)
 
-func getRotateSign() int {
-	t_case := time.Now()
-	return t_case.Year()*1000000 + int(t_case.Month())*10000 + t_case.Day()*100 + t_case.Hour()
-}
+		//warning and fatal go to wf file
+		l.addRoute(&logRoute{sink: &logFileSink{l: l}, name: l.File, min: LOG_DEBUG, max: LOG_WARN - 1})
+		l.addRoute(&logRoute{sink: &logFileSink{l: l, wf: true}, name: l.File + ".wf", min: LOG_WARN, max: LOG_FATAL})
+	}
 
-func (l *Log) rotate() error {
-	if !l.Rotate {
-		return nil
+	for _, route := range routes {
+		l.addRoute(route)
+	}
+	if len(l.routes) == 0 {
+		l.addRoute(&logRoute{sink: NewLogWriterSink(os.Stdout), name: "stdout", min: LOG_DEBUG, max: LOG_FATAL})
 	}
 
-	curr_rotate_sign := getRotateSign()
-	if l.CurrRotateSign == curr_rotate_sign {
-		return nil
+	if conf.Async {
+		l.Async = true
+		l.BufferSize = conf.BufferSize
+		if l.BufferSize <= 0 {
+			l.BufferSize = logBufferSize
+		}
+		l.Overflow = strings.ToLower(conf.Overflow)
+		if l.Overflow == "" {
+			l.Overflow = LOG_OVERFLOW_BLOCK
+		}
+		if l.Overflow != LOG_OVERFLOW_BLOCK && l.Overflow != LOG_OVERFLOW_DROP && l.Overflow != LOG_OVERFLOW_DROPLOW {
+			io.WriteString(os.Stdout, "log overflow policy invalid, we set to block\n")
+			l.Overflow = LOG_OVERFLOW_BLOCK
+		}
+		l.FlushTimeout = conf.FlushTimeout
+		if l.FlushTimeout <= 0 {
+			l.FlushTimeout = logFlushTimeout
+		}
+		l.startAsync()
 	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.nfd != nil {
-		l.nfd.Close()
+	if conf.SampleFirst > 0 {
+		l.SampleFirst = conf.SampleFirst
+		l.SampleThereafter = conf.SampleThereafter
+		l.SampleBy = strings.ToLower(conf.SampleBy)
+		if l.SampleBy == "" {
+			l.SampleBy = LOG_SAMPLE_CALLER
+		}
+		if l.SampleBy != LOG_SAMPLE_CALLER && l.SampleBy != LOG_SAMPLE_MESSAGE {
+			io.WriteString(os.Stdout, "log sample key invalid, we set to caller\n")
+			l.SampleBy = LOG_SAMPLE_CALLER
+		}
+		l.SampleReport = conf.SampleReport
+		if l.SampleReport <= 0 {
+			l.SampleReport = logSampleReport
+		}
+		l.startSampler()
 	}
-	if l.wfd != nil {
-		l.wfd.Close()
+
+	if conf.ReopenOnSignal {
+		l.ReopenOnSignal()
 	}
 
-	nlfile := fmt.Sprintf("%s.%d", l.File, curr_rotate_sign)
-	wlfile := fmt.Sprintf("%s.wf.%d", l.File, curr_rotate_sign)
+	return l, nil
+}
 
-	//open file and add log handler
-	var err error
-	l.nfd, err = os.OpenFile(nlfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.ModeSetuid|os.ModeSetgid|0660)
-	if err != nil {
-		//todo: to write error msg to stderr
-		return err
+func (l *Log) WriteLog(level int, v ...interface{}) {
+	l.output(3, level, nil, v...)
+}
+
+//output write a log line, calldepth is frames to skip for caller,
+//0 is output itself, same as log.Logger.Output plus one
+//fields are put after basic fields, see Entry
+func (l *Log) output(calldepth int, level int, fields map[string]interface{}, v ...interface{}) {
+	pc, caller := logCaller(calldepth)
+	//frames from closure, output and more
+	stack := func() []runtime.Frame { return logFrames(calldepth + 2) }
+	l.outputAt(logNow(), pc, caller, stack, level, fields, v...)
+}
+
+//outputAt write a log line logged at pc, stack is called only when line needs stack
+func (l *Log) outputAt(now time.Time, pc uintptr, caller string, stack func() []runtime.Frame, level int, fields map[string]interface{}, v ...interface{}) {
+	if level < l.levelOf(pc) {
+		return
 	}
 
-	l.wfd, err = os.OpenFile(wlfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.ModeSetuid|os.ModeSetgid|0660)
-	if err != nil {
-		//todo: to write error msg to stderr
-		return err
+	if !l.sampled(now, level, pc, v...) {
+		return
 	}
 
-	// normal Log Handler
-	l.nlog = log.New(l.nfd, "", log.Ldate|log.Ltime|log.Lshortfile)
+	call := logCall{caller: caller}
+	if l.CallerFunc {
+		call.fn = logFuncName(pc)
+	}
+	if level >= l.StackLevel {
+		call.stack = formatLogFrames(stack())
+	}
 
-	// wrong log Handler
-	l.wlog = log.New(l.wfd, "", log.Ldate|log.Ltime|log.Lshortfile)
+	//step1: gen log string
+	log_str := l.formatLine(now, call, level, fields, v...)
 
-	//when rotate done, we change the sign ,for we can reentrant
-	l.CurrRotateSign = curr_rotate_sign
-	return nil
+	//step2: write log
+	l.send(now, level, log_str)
 }
 
-func (l *Log) WriteLog(level int, v ...interface{}) {
-	//step1: rotate
-	if l.rotate() != nil {
+//send formatted line, async lines are written by background goroutine
+func (l *Log) send(now time.Time, level int, log_str string) {
+	if l.async != nil {
+		l.push(&logLine{now: now, level: level, line: log_str})
+		//fatal may be the last words before exit
+		if level >= LOG_FATAL {
+			l.Flush()
+		}
 		return
 	}
+	l.write(now, level, log_str)
+}
 
-	//step2: gen log string
-	log_str := l.genLogString(level, v...)
+//formatLine a log line in text or json format
+func (l *Log) formatLine(now time.Time, call logCall, level int, fields map[string]interface{}, v ...interface{}) string {
+	if l.Format == LOG_FORMAT_JSON {
+		return l.genLogJson(now, call, level, fields, v...)
+	}
 
-	//step3: write log
-	if level < LOG_WARN {
-		l.nlog.Output(3, log_str)
-	} else {
-		l.wlog.Output(3, log_str)
+	header := now.Format("2006/01/02 15:04:05") + " " + call.caller
+	if call.fn != "" {
+		header += " " + call.fn
+	}
+	log_str := header + ": " + l.genLogString(level, fields, v...)
+	if len(call.stack) > 0 {
+		log_str = strings.TrimSuffix(log_str, "\n") + " stack[" + strings.Join(call.stack, " ") + "]\n"
 	}
+	return log_str
+}
+
+//write a formatted line to file by level, rotate first if needed
+func (l *Log) write(now time.Time, level int, log_str string) {
+	l.rotate(now)
 
-	return
+	//files are not switched while writing
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	//lines after close are lost
+	if l.closed {
+		return
+	}
+	l.writeRoutes(level, log_str)
+}
+
+//logCaller pc and short file name and line like log.Lshortfile
+func logCaller(calldepth int) (uintptr, string) {
+	pc, file, line, ok := runtime.Caller(calldepth + 1)
+	if !ok {
+		return 0, "???:0"
+	}
+	return pc, filepath.Base(file) + ":" + strconv.Itoa(line)
 }
 
-//todo
-func (l *Log) genLogString(level int, v ...interface{}) string {
+func (l *Log) genLogString(level int, fields map[string]interface{}, v ...interface{}) string {
+	basic := ""
+	if basic_fields := l.basicFields(); len(basic_fields) > 0 {
+		basic = " " + strings.TrimSpace(l.dealFields(basic_fields))
+	}
+	if len(fields) > 0 {
+		basic += " " + strings.TrimSpace(l.dealFields(fields))
+	}
+
 	if len(v) >= 2 {
 		format_str, err := v[0].(string)
 
 		//if v[0] is string
 		if err {
-			return strings.TrimSpace(fmt.Sprintf("["+logString[level]+"] "+format_str, v[1:]...)) + "\n"
+			return strings.TrimSpace("["+logString[level]+"]"+basic+" "+fmt.Sprintf(format_str, v[1:]...)) + "\n"
 		}
 	}
 
 	var res bytes.Buffer
-	res.WriteString("[" + logString[level] + "]")
+	res.WriteString("[" + logString[level] + "]" + basic)
 	//compate with multi params
 	for _, val := range v {
 		res.WriteString(" ")
@@ -243,6 +616,10 @@ func (l *Log) genLogString(level int, v ...interface{}) string {
 }
 
 func (l *Log) dealFields(v interface{}) string {
+	if err, ok := v.(error); ok && err != nil {
+		return logErrorString(err)
+	}
+
 	//now we just deal string ,map and
 	value := reflect.ValueOf(v)
 	var vKind = value.Kind()
@@ -275,6 +652,10 @@ func (l *Log) dealFields(v interface{}) string {
 	case vKind == 21:
 		var res bytes.Buffer
 		keys := value.MapKeys()
+		//stable order for log parsers
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprintf("%v", keys[i]) < fmt.Sprintf("%v", keys[j])
+		})
 
 		for _, key := range keys {
 			res.WriteString(fmt.Sprintf("%v[%v] ", key, value.MapIndex(key)))
@@ -304,88 +685,194 @@ func (l *Log) dealFields(v interface{}) string {
 	default:
 		return "Unknown"
 	}
-
-	return "Unknown"
 }
 
+// LogDestory close default log, package functions write nothing after it
 func LogDestory() {
-	if logHdr == nil {
-		return
+	if old := LogSetDefault(nil); old != nil {
+		old.Close()
 	}
+}
+
+// Close stop background goroutines, write buffered lines and close files and sinks,
+// lines logged after close are lost
+func (l *Log) Close() {
+	l.closeOnce.Do(func() {
+		//no reopen after files closed
+		l.stopReopen()
+
+		//report suppressed lines before drain
+		if l.sampler != nil {
+			l.stopSampler()
+		}
+
+		//drain async buffer before close files
+		if l.async != nil {
+			l.stopAsync()
+		}
+
+		//wait for lines being written
+		l.mu.Lock()
+		l.closed = true
+		l.closeSinks()
+		if l.nfd != nil {
+			l.nfd.Close()
+		}
+		if l.wfd != nil {
+			l.wfd.Close()
+		}
+		l.nfd, l.wfd = nil, nil
+		l.mu.Unlock()
 
-	if logHdr.nfd != nil {
-		logHdr.nfd.Close()
+		//no rotate starts cleanup after closed, cleanup reads current suffix under l.mu
+		l.cleanupWg.Wait()
+	})
+}
+
+// LogAddBasic add a field to every log line, replace it if key exists
+func LogAddBasic(key string, value interface{}) {
+	if l := logDefault(); l != nil {
+		l.AddBasic(key, value)
+	}
+}
+
+// LogRmBasic remove a basic field
+func LogRmBasic(key string) {
+	if l := logDefault(); l != nil {
+		l.RmBasic(key)
 	}
-	if logHdr.wfd != nil {
-		logHdr.wfd.Close()
+}
+
+// AddBasic add a field to every log line, replace it if key exists
+func (l *Log) AddBasic(key string, value interface{}) {
+	l.basicMu.Lock()
+	defer l.basicMu.Unlock()
+
+	//copy on write, so lines being written keep a consistent view
+	fields := make(map[string]interface{}, len(l.BasicFields)+1)
+	for k, v := range l.BasicFields {
+		fields[k] = v
 	}
-	logHdr = nil
+	fields[key] = value
+	l.BasicFields = fields
 }
 
-//todo
-func LogAddBasic() {
+// RmBasic remove a basic field
+func (l *Log) RmBasic(key string) {
+	l.basicMu.Lock()
+	defer l.basicMu.Unlock()
+
+	fields := make(map[string]interface{}, len(l.BasicFields))
+	for k, v := range l.BasicFields {
+		if k != key {
+			fields[k] = v
+		}
+	}
+	l.BasicFields = fields
 }
 
-//todo
-func LogRmBasic() {
+//basicFields current basic fields, must not be modified
+func (l *Log) basicFields() map[string]interface{} {
+	l.basicMu.RLock()
+	defer l.basicMu.RUnlock()
+	return l.BasicFields
 }
 
 func LogDebug(v ...interface{}) {
-	if logHdr == nil {
+	if logToSlog(1, LOG_DEBUG, nil, v...) {
 		return
 	}
-
-	if LOG_DEBUG < logHdr.Level {
+	l := logDefault()
+	if l == nil || !l.enabled(LOG_DEBUG) {
 		return
 	}
 
-	logHdr.WriteLog(LOG_DEBUG, v...)
+	l.WriteLog(LOG_DEBUG, v...)
 }
 
 func LogTrace(v ...interface{}) {
-	if logHdr == nil {
+	if logToSlog(1, LOG_TRACE, nil, v...) {
 		return
 	}
-
-	if LOG_TRACE < logHdr.Level {
+	l := logDefault()
+	if l == nil || !l.enabled(LOG_TRACE) {
 		return
 	}
 
-	logHdr.WriteLog(LOG_TRACE, v...)
+	l.WriteLog(LOG_TRACE, v...)
 }
 
 func LogNotice(v ...interface{}) {
-	if logHdr == nil {
+	if logToSlog(1, LOG_NOTICE, nil, v...) {
 		return
 	}
-
-	if LOG_NOTICE < logHdr.Level {
+	l := logDefault()
+	if l == nil || !l.enabled(LOG_NOTICE) {
 		return
 	}
 
-	logHdr.WriteLog(LOG_NOTICE, v...)
+	l.WriteLog(LOG_NOTICE, v...)
 }
 
 func LogWarn(v ...interface{}) {
-	if logHdr == nil {
+	if logToSlog(1, LOG_WARN, nil, v...) {
 		return
 	}
-
-	if LOG_WARN < logHdr.Level {
+	l := logDefault()
+	if l == nil || !l.enabled(LOG_WARN) {
 		return
 	}
 
-	logHdr.WriteLog(LOG_WARN, v...)
+	l.WriteLog(LOG_WARN, v...)
 }
 
 func LogFatal(v ...interface{}) {
-	if logHdr == nil {
+	if logToSlog(1, LOG_FATAL, nil, v...) {
 		return
 	}
+	l := logDefault()
+	if l == nil || !l.enabled(LOG_FATAL) {
+		return
+	}
+
+	l.WriteLog(LOG_FATAL, v...)
+}
+
+// Debug log at debug level, nil log writes to default log
+func (l *Log) Debug(v ...interface{}) {
+	l.logAt(LOG_DEBUG, v...)
+}
 
-	if LOG_FATAL < logHdr.Level {
+// Trace log at trace level, nil log writes to default log
+func (l *Log) Trace(v ...interface{}) {
+	l.logAt(LOG_TRACE, v...)
+}
+
+// Notice log at notice level, nil log writes to default log
+func (l *Log) Notice(v ...interface{}) {
+	l.logAt(LOG_NOTICE, v...)
+}
+
+// Warn log at warning level, nil log writes to default log
+func (l *Log) Warn(v ...interface{}) {
+	l.logAt(LOG_WARN, v...)
+}
+
+// Fatal log at fatal level, nil log writes to default log
+func (l *Log) Fatal(v ...interface{}) {
+	l.logAt(LOG_FATAL, v...)
+}
+
+func (l *Log) logAt(level int, v ...interface{}) {
+	if l == nil {
+		if logToSlog(2, level, nil, v...) {
+			return
+		}
+		l = logDefault()
+	}
+	if l == nil || !l.enabled(level) {
 		return
 	}
 
-	logHdr.WriteLog(LOG_FATAL, v...)
+	l.output(3, level, nil, v...)
 }
@@ -0,0 +1,764 @@
+package larix
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func readLogFile(t *testing.T, file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read log file %s failed: %s", file, err)
+	}
+	return string(data)
+}
+
+func Test_LogJsonFormat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file, Format: "json"}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	type point struct {
+		X int
+		Y int
+	}
+	LogWarn(map[string]interface{}{
+		"message": "request failed",
+		"point":   &point{1, 2},
+		"ids":     []int{1, 2},
+	}, "retry")
+	LogNotice("count %d", 3)
+
+	line := readLogFile(t, file+".wf")
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("log line is not json: %s", line)
+	}
+	if entry["level"] != "warning" || entry["msg"] != "retry" || entry["message"] != "request failed" {
+		t.Errorf("json log entry = %v", entry)
+	}
+	if !strings.HasPrefix(entry["caller"].(string), "log_test.go:") {
+		t.Errorf("caller = %v, want log_test.go", entry["caller"])
+	}
+	want := `"ids":[1,2],"message":"request failed","point":{"X":1,"Y":2},"msg":"retry"}`
+	if !strings.HasSuffix(strings.TrimSpace(line), want) {
+		t.Errorf("json fields not in stable order: %s", line)
+	}
+
+	//nil pointer error in fields
+	var path_err *os.PathError
+	LogNotice(map[string]interface{}{"err": path_err}, "nil error field")
+	if line := readLogFile(t, file); !strings.Contains(line, `"err":"<nil>","msg":"nil error field"`) {
+		t.Errorf("nil error field log = %s", line)
+	}
+
+	//params not in map are encoded too
+	LogNotice(&point{1, 2})
+	LogNotice(point{3, 4}, []int{1, 2}, 5, "moved")
+	lines := strings.Split(strings.TrimSpace(readLogFile(t, file)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("notice log = %q", lines)
+	}
+	if !strings.Contains(lines[0], `"msg":"count 3"`) {
+		t.Errorf("notice log = %s", lines[0])
+	}
+	if !strings.HasSuffix(lines[2], `"msg":"","args":[{"X":1,"Y":2}]}`) {
+		t.Errorf("pointer param log = %s", lines[2])
+	}
+	if !strings.HasSuffix(lines[3], `"msg":"5 moved","args":[{"X":3,"Y":4},[1,2]]}`) {
+		t.Errorf("struct param log = %s", lines[3])
+	}
+}
+
+func Test_LogTextFormat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	LogNotice(map[string]interface{}{"b": 2, "a": 1})
+
+	line := readLogFile(t, file)
+	if !strings.Contains(line, " log_test.go:") || !strings.HasSuffix(line, "[notice] a[1] b[2]\n") {
+		t.Errorf("text log line = %q", line)
+	}
+}
+
+func Test_LogBasicFields(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file, Format: "json", Basic: "service:order, version:1.0"}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	LogAddBasic("pid", 100)
+	LogRmBasic("version")
+	LogNotice("start")
+
+	line := readLogFile(t, file)
+	if !strings.Contains(line, `"pid":100,"service":"order","msg":"start"`) {
+		t.Errorf("json log without basic fields: %s", line)
+	}
+
+	//same key once, param over entry over basic
+	LogWith(map[string]interface{}{"pid": 200, "user": "entry"}).Notice(map[string]interface{}{"user": "param"}, "collide")
+	lines := strings.Split(strings.TrimSpace(readLogFile(t, file)), "\n")
+	if line := lines[len(lines)-1]; !strings.HasSuffix(line, `"pid":200,"service":"order","user":"param","msg":"collide"}`) {
+		t.Errorf("json log with colliding fields: %s", line)
+	}
+}
+
+func Test_LogEntry(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file, Level: LOG_TRACE}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	ctx := LogNewContext(context.Background(), LogWith(map[string]interface{}{"req_id": "r1"}))
+	entry := LogFromContext(ctx).With(map[string]interface{}{"user": "u1"})
+	entry.Debug("dropped by level")
+	entry.Notice("order %s created", "o1")
+
+	line := readLogFile(t, file)
+	if !strings.Contains(line, "log_test.go:") || !strings.HasSuffix(line, "[notice] req_id[r1] user[u1] order o1 created\n") {
+		t.Errorf("entry log line = %q", line)
+	}
+}
+
+func Test_LogRotatePolicy(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.log")
+
+	now := time.Date(2026, 10, 18, 23, 0, 0, 0, time.Local)
+	logNow = func() time.Time { return now }
+	defer func() { logNow = time.Now }()
+
+	err := LogInit(&LogConf{File: file, Rotate: true, RotateBy: "day", MaxBackups: 1, Compress: true, Symlink: true})
+	if err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	for day := 0; day < 3; day++ {
+		now = now.AddDate(0, 0, 1)
+		LogNotice("day %d", day)
+	}
+	//cleanup runs in background
+	LogDefault().cleanupWg.Wait()
+
+	if target, _ := os.Readlink(file); target != "test.log.20261021" {
+		t.Errorf("symlink points to %s, want test.log.20261021", target)
+	}
+	if !strings.Contains(readLogFile(t, file), "day 2") {
+		t.Error("symlink should follow current file")
+	}
+
+	matches, _ := filepath.Glob(file + ".2*")
+	sort.Strings(matches)
+	want := []string{file + ".20261020.gz", file + ".20261021"}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("log files = %v, want %v", matches, want)
+	}
+}
+
+func Test_LogRotateBySize(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file, Rotate: true, RotateBy: "size", MaxSize: 100}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	for i := 0; i < 10; i++ {
+		LogNotice("a line longer than ten bytes")
+	}
+
+	matches, _ := filepath.Glob(file + ".2*")
+	if len(matches) < 3 {
+		t.Errorf("rotate by size files = %v, want more", matches)
+	}
+}
+
+func Test_LogRotateConcurrent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+
+	var clock int64 = time.Date(2026, 10, 18, 10, 59, 59, 0, time.Local).UnixNano()
+	logNow = func() time.Time { return time.Unix(0, atomic.LoadInt64(&clock)) }
+	defer func() { logNow = time.Now }()
+
+	if err := LogInit(&LogConf{File: file, Rotate: true}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	const writers, lines = 20, 200
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				//cross the hour boundary while others are writing
+				if i == 0 && j == lines/2 {
+					atomic.AddInt64(&clock, int64(time.Second))
+				}
+				LogNotice("writer %d line %d", i, j)
+				LogWarn("writer %d line %d", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, name := range []string{file, file + ".wf"} {
+		total := 0
+		for _, suffix := range []string{".2026101810", ".2026101811"} {
+			total += strings.Count(readLogFile(t, name+suffix), "\n")
+		}
+		if total != writers*lines {
+			t.Errorf("%s lines = %d, want %d", name, total, writers*lines)
+		}
+	}
+}
+
+func Test_LogAsync(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file, Async: true, BufferSize: 2, Overflow: "drop"}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	//writer goroutine waits for files while we hold the lock, so buffer gets full
+	LogDefault().mu.Lock()
+	for i := 0; i < 10; i++ {
+		LogNotice("line %d", i)
+	}
+	LogDefault().mu.Unlock()
+
+	dropped := LogDropped()
+	if dropped < 7 {
+		t.Errorf("dropped = %d, want at least 7", dropped)
+	}
+	if err := LogFlush(); err != nil {
+		t.Fatalf("LogFlush failed: %s", err)
+	}
+
+	lines := strings.Count(readLogFile(t, file), "\n")
+	if uint64(lines)+dropped != 10 {
+		t.Errorf("written %d lines and dropped %d, want 10 in total", lines, dropped)
+	}
+	if !strings.Contains(readLogFile(t, file+".wf"), "dropped "+strconv.FormatUint(dropped, 10)+" lines") {
+		t.Error("dropped lines should be reported in wf file")
+	}
+
+	//fatal is flushed at once
+	LogFatal("fatal line")
+	if !strings.Contains(readLogFile(t, file+".wf"), "fatal line") {
+		t.Error("fatal line should be flushed")
+	}
+}
+
+func Test_LogSinks(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp failed: %s", err)
+	}
+	defer tcp.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp failed: %s", err)
+	}
+	defer udp.Close()
+	sock := filepath.Join(t.TempDir(), "syslog.sock")
+	syslog, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatalf("listen unixgram failed: %s", err)
+	}
+	defer syslog.Close()
+
+	sinks := "tcp://" + tcp.Addr().String() + "?level=warning, udp://" + udp.LocalAddr().String() + "?max=notice, syslog://" + sock + "?tag=test"
+	if err := LogInit(&LogConf{File: "", Sinks: sinks}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	LogNotice("notice line")
+	LogWarn("warn line")
+
+	conn, err := tcp.Accept()
+	if err != nil {
+		t.Fatalf("accept failed: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, _ := bufio.NewReader(conn).ReadString('\n')
+	if !strings.Contains(line, "[warning] warn line") {
+		t.Errorf("tcp got %q, want only warn line", line)
+	}
+
+	buf := make([]byte, 1024)
+	udp.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, _ := udp.ReadFrom(buf)
+	if !strings.Contains(string(buf[:n]), "[notice] notice line") {
+		t.Errorf("udp got %q, want notice line", buf[:n])
+	}
+
+	syslog.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, _ = syslog.ReadFrom(buf)
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<13>") || !strings.Contains(msg, " test[") || !strings.HasSuffix(msg, "notice line") {
+		t.Errorf("syslog got %q", msg)
+	}
+}
+
+func Test_LogNetSinkQueue(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp failed: %s", err)
+	}
+	defer tcp.Close()
+	sink, err := NewLogNetSink("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatalf("NewLogNetSink failed: %s", err)
+	}
+
+	//collector never reads, write goroutine blocks when socket buffer is full
+	line := strings.Repeat("x", 1<<20) + "\n"
+	start := time.Now()
+	dropped := 0
+	for i := 0; i < logNetQueue+100; i++ {
+		if sink.Write(LOG_NOTICE, line) != nil {
+			dropped++
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("write to blocked sink takes %s", elapsed)
+	}
+	if dropped == 0 {
+		t.Error("lines should be dropped when queue is full")
+	}
+
+	//collector gone, queued lines fail fast
+	conn, err := tcp.Accept()
+	if err != nil {
+		t.Fatalf("accept failed: %s", err)
+	}
+	conn.Close()
+	tcp.Close()
+	sink.Close()
+	if err := sink.Write(LOG_NOTICE, "after close\n"); err == nil {
+		t.Error("write after close should fail")
+	}
+}
+
+func Test_NewLogFailedSinks(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp failed: %s", err)
+	}
+	defer tcp.Close()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+
+	before := runtime.NumGoroutine()
+	sinks := "tcp://" + tcp.Addr().String() + ", syslog"
+	for _, conf := range []*LogConf{
+		{Sinks: sinks + ", ftp://127.0.0.1"},
+		{File: filepath.Join(dir, "file", "sub", "test.log"), Sinks: sinks},
+	} {
+		if _, err := NewLog(conf); err == nil {
+			t.Errorf("NewLog with %+v should fail", conf)
+		}
+	}
+	//sink goroutines exit when closed
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines = %d after failed NewLog, want %d", after, before)
+	}
+}
+
+func Test_LogLevels(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.log")
+	c, err := NewConf(writeConfFile(t, "log.ini", "[log]\nfile = "+file+"\nlevel = warning\nmodules = github.com/kstrwind/lib-go/larixfoo:debug\n"))
+	if err != nil {
+		t.Fatalf("NewConf failed: %s", err)
+	}
+	var conf LogConf
+	if err := c.UnmarshalSection("log", &conf); err != nil {
+		t.Fatalf("UnmarshalSection failed: %s", err)
+	}
+	if conf.LevelName != "warning" {
+		t.Errorf("level = %s, want warning", conf.LevelName)
+	}
+	if err := LogInit(&conf); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	if level := LogGetLevel(); level != LOG_WARN {
+		t.Errorf("log level = %d, want warning", level)
+	}
+	defer LogDestory()
+
+	//module larixfoo is not a prefix of larix
+	LogNotice("dropped by level")
+	if err := LogSetModuleLevel("github.com/kstrwind/lib-go/larix", LOG_NOTICE); err != nil {
+		t.Fatalf("LogSetModuleLevel failed: %s", err)
+	}
+	LogNotice("logged by module level")
+	LogDebug("dropped by module level")
+
+	handler := LogLevelHandler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/?level=fatal", nil))
+	if rec.Code != 200 || LogGetLevel() != LOG_FATAL {
+		t.Errorf("set level by http got %d, level %d", rec.Code, LogGetLevel())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("DELETE", "/?module=github.com/kstrwind/lib-go/larix", nil))
+	LogWarn("dropped after module removed")
+
+	var state map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &state)
+	want := map[string]interface{}{"level": "fatal", "modules": map[string]interface{}{"github.com/kstrwind/lib-go/larixfoo": "debug"}}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("levels = %v, want %v", state, want)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/?level=loud", nil))
+	if rec.Code != 400 {
+		t.Errorf("invalid level got %d, want 400", rec.Code)
+	}
+
+	content := readLogFile(t, file) + readLogFile(t, file+".wf")
+	if strings.Contains(content, "dropped") || !strings.Contains(content, "logged by module level") {
+		t.Errorf("log content = %q", content)
+	}
+}
+
+func Test_LogSampling(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+	logNow = func() time.Time { return now }
+	defer func() { logNow = time.Now }()
+
+	if err := LogInit(&LogConf{File: file, SampleFirst: 2, SampleThereafter: 5}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	//first 2, then the 7th, 12th, 17th and 22nd in the same second
+	for i := 1; i <= 22; i++ {
+		LogWarn("retry %d", i)
+	}
+	//other callsite has its own quota
+	LogWarn("other callsite")
+	LogDestory()
+
+	content := readLogFile(t, file+".wf")
+	for _, i := range []int{1, 2, 7, 12, 17, 22} {
+		if !strings.Contains(content, "retry "+strconv.Itoa(i)+"\n") {
+			t.Errorf("line %d should be logged", i)
+		}
+	}
+	if strings.Count(content, "retry") != 6 || !strings.Contains(content, "other callsite") {
+		t.Errorf("sampled content = %q", content)
+	}
+	if !strings.Contains(content, "log sampling suppressed 16 lines") {
+		t.Error("suppressed lines should be reported")
+	}
+}
+
+func Test_LogCallerAndErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file, Format: "json", CallerFunc: true, StackLevel: "warning"}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	_, open_err := os.Open(filepath.Join(t.TempDir(), "missing"))
+	LogNotice("no stack below warning")
+	LogWarn("open failed: %v", fmt.Errorf("load conf: %w", open_err))
+
+	var notice, warn map[string]interface{}
+	json.Unmarshal([]byte(readLogFile(t, file)), &notice)
+	json.Unmarshal([]byte(readLogFile(t, file+".wf")), &warn)
+
+	if notice["func"] != "larix.Test_LogCallerAndErrors" || notice["stack"] != nil {
+		t.Errorf("notice line = %v", notice)
+	}
+	if !strings.HasPrefix(fmt.Sprint(warn["msg"]), "open failed: load conf: open ") || warn["error_type"] != "syscall.Errno" {
+		t.Errorf("warn line = %v", warn)
+	}
+	if causes, _ := warn["error_causes"].([]interface{}); len(causes) != 2 || causes[1] != "no such file or directory" {
+		t.Errorf("error causes = %v", warn["error_causes"])
+	}
+	if _, exists := warn["error"]; exists {
+		t.Errorf("error in msg should not be repeated, warn line = %v", warn)
+	}
+	if stack, _ := warn["stack"].([]interface{}); len(stack) == 0 || !strings.HasPrefix(stack[0].(string), "larix.Test_LogCallerAndErrors(") {
+		t.Errorf("stack = %v", warn["stack"])
+	}
+}
+
+func Test_LogTextErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	//error fields are for json, text lines are not changed
+	LogWarn("request failed: %v", fmt.Errorf("wrap: %w", os.ErrNotExist))
+	if line := readLogFile(t, file+".wf"); !strings.HasSuffix(line, "[warning] request failed: wrap: file does not exist\n") {
+		t.Errorf("text error line = %q", line)
+	}
+}
+
+func Test_LogNilErrors(t *testing.T) {
+	dir := t.TempDir()
+	var path_err *os.PathError
+	for _, format := range []string{"text", "json"} {
+		file := filepath.Join(dir, format+".log")
+		l, err := NewLog(&LogConf{File: file, Format: format})
+		if err != nil {
+			t.Fatalf("NewLog failed: %s", err)
+		}
+		l.Warn(path_err)
+		l.Warn("open failed: %v", path_err)
+		l.Warn(fmt.Errorf("wrap: %w", path_err))
+		l.Close()
+
+		lines := strings.Split(strings.TrimSpace(readLogFile(t, file+".wf")), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("%s log of nil errors = %q", format, lines)
+		}
+		for _, line := range lines {
+			if !strings.Contains(line, "<nil>") {
+				t.Errorf("%s log of nil error = %q", format, line)
+			}
+		}
+		if format == "json" && (strings.Contains(lines[0], "error_type") || !strings.Contains(lines[2], `"error_type":"*fs.PathError"`)) {
+			t.Errorf("json error fields of nil errors = %q", lines)
+		}
+	}
+}
+
+func Test_LogPanic(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recover got %v, want boom", r)
+			}
+		}()
+		defer LogPanic()
+		panic("boom")
+	}()
+
+	content := readLogFile(t, file+".wf")
+	if !strings.Contains(content, "log_test.go") || !strings.Contains(content, "[fatal] panic: boom stack[larix.Test_LogPanic.func1(") {
+		t.Errorf("panic line = %q", content)
+	}
+}
+
+func Test_LogSlog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	if err := LogInit(&LogConf{File: file, Format: "json", Level: LOG_TRACE}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	logger := slog.New(NewLogSlogHandler(nil)).With("service", "order").WithGroup("req")
+	logger.Debug("below trace")
+	logger.Warn("request failed", "method", "POST", slog.Group("retry", "count", 3))
+
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(readLogFile(t, file+".wf")), &line); err != nil {
+		t.Fatalf("decode line failed: %s", err)
+	}
+	want := map[string]interface{}{"level": "warning", "msg": "request failed", "service": "order", "req.method": "POST", "req.retry.count": float64(3)}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("key %s = %v, want %v", key, line[key], value)
+		}
+	}
+	if !strings.HasPrefix(line["caller"].(string), "log_test.go:") {
+		t.Errorf("caller = %v, want log_test.go", line["caller"])
+	}
+	if readLogFile(t, file) != "" {
+		t.Error("slog debug should be dropped below trace")
+	}
+
+	//larix to slog
+	var buf bytes.Buffer
+	LogSetSlog(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug})))
+	defer LogSetSlog(nil)
+
+	LogWith(map[string]interface{}{"trace_id": "t1"}).Trace("traced")
+	LogNotice(map[string]interface{}{"method": "GET"}, "forwarded")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("slog got %q, want 2 lines", buf.String())
+	}
+	var trace, notice map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &trace)
+	json.Unmarshal([]byte(lines[1]), &notice)
+	if trace["level"] != "DEBUG+2" || trace["trace_id"] != "t1" {
+		t.Errorf("trace line = %v", trace)
+	}
+	source, _ := notice["source"].(map[string]interface{})
+	if notice["level"] != "INFO" || notice["msg"] != "forwarded" || notice["method"] != "GET" || !strings.HasSuffix(fmt.Sprint(source["file"]), "log_test.go") {
+		t.Errorf("notice line = %v", notice)
+	}
+}
+
+func Test_NewLog(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewLog(&LogConf{File: filepath.Join(dir, "first.log"), Level: LOG_WARN})
+	if err != nil {
+		t.Fatalf("NewLog failed: %s", err)
+	}
+	defer first.Close()
+	second, err := NewLog(&LogConf{File: filepath.Join(dir, "second.log")})
+	if err != nil {
+		t.Fatalf("NewLog failed: %s", err)
+	}
+	defer second.Close()
+
+	first.Notice("dropped by first level")
+	second.Notice("to second")
+	if content := readLogFile(t, filepath.Join(dir, "first.log")); content != "" {
+		t.Errorf("first log = %q, want empty", content)
+	}
+	if content := readLogFile(t, filepath.Join(dir, "second.log")); !strings.Contains(content, "log_test.go") || !strings.Contains(content, "[notice] to second") {
+		t.Errorf("second log = %q", content)
+	}
+
+	if _, err := NewLog(&LogConf{File: filepath.Join(dir, "first.log", "test.log")}); err == nil {
+		t.Error("NewLog should fail when file can't be opened")
+	}
+	if _, err := NewLog(&LogConf{Sinks: "ftp://127.0.0.1"}); err == nil {
+		t.Error("NewLog should fail when sink not support")
+	}
+
+	//init again replaces default log, nil log writes to default
+	if err := LogInit(&LogConf{File: filepath.Join(dir, "old.log")}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	if err := LogInit(&LogConf{File: filepath.Join(dir, "new.log")}); err != nil {
+		t.Fatalf("LogInit failed: %s", err)
+	}
+	defer LogDestory()
+
+	var client *Log
+	client.Notice("to default")
+	if content := readLogFile(t, filepath.Join(dir, "new.log")); !strings.Contains(content, "log_test.go") || !strings.Contains(content, "to default") {
+		t.Errorf("new default log = %q", content)
+	}
+	//closed log neither writes nor rotates
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+	logNow = func() time.Time { return now }
+	defer func() { logNow = time.Now }()
+	rotated, err := NewLog(&LogConf{File: filepath.Join(dir, "rotated.log"), Rotate: true})
+	if err != nil {
+		t.Fatalf("NewLog failed: %s", err)
+	}
+	rotated.Close()
+	now = now.Add(time.Hour)
+	rotated.Notice("after close")
+	if matches, _ := filepath.Glob(filepath.Join(dir, "rotated.log*")); len(matches) != 2 {
+		t.Errorf("log files after close = %v", matches)
+	}
+	if rotated.nfd != nil || rotated.wfd != nil {
+		t.Error("closed log should not open files")
+	}
+}
+
+func Test_LogFileModeAndReopen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs", "app")
+	file := filepath.Join(dir, "test.log")
+	owner := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	l, err := NewLog(&LogConf{File: file, FileMode: "0600", DirMode: "0700", Owner: owner, ReopenOnSignal: true})
+	if err != nil {
+		t.Fatalf("NewLog failed: %s", err)
+	}
+	defer l.Close()
+
+	for name, want := range map[string]os.FileMode{dir: 0700, filepath.Dir(dir): 0700, file: 0600, file + ".wf": 0600} {
+		info, err := os.Stat(name)
+		if err != nil || info.Mode().Perm() != want {
+			t.Errorf("mode of %s = %v, want %v", name, info.Mode().Perm(), want)
+		}
+	}
+
+	if _, err := NewLog(&LogConf{File: file, Owner: "larix-no-such-user"}); err == nil {
+		t.Error("NewLog should fail when owner not found")
+	}
+	if _, err := NewLog(&LogConf{File: filepath.Join(file, "sub", "test.log")}); err == nil || !strings.Contains(err.Error(), "create log dir failed") {
+		t.Errorf("NewLog with file as dir err = %v", err)
+	}
+
+	//moved by external logrotate
+	l.Notice("before move")
+	if err := os.Rename(file, file+".1"); err != nil {
+		t.Fatalf("move log file failed: %s", err)
+	}
+	l.Notice("after move")
+	if err := l.Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %s", err)
+	}
+	l.Notice("after reopen")
+	if content := readLogFile(t, file+".1"); !strings.Contains(content, "before move") || !strings.Contains(content, "after move") {
+		t.Errorf("moved log = %q", content)
+	}
+	if content := readLogFile(t, file); strings.Contains(content, "move") || !strings.Contains(content, "after reopen") {
+		t.Errorf("reopened log = %q", content)
+	}
+
+	if len(logReopenSignals) == 0 {
+		return
+	}
+	os.Rename(file, file+".2")
+	process, _ := os.FindProcess(os.Getpid())
+	process.Signal(logReopenSignals[0])
+	for i := 0; i < 100 && !logFileExists(file); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	l.Notice("after signal")
+	if content := readLogFile(t, file); !strings.Contains(content, "after signal") {
+		t.Errorf("log reopened by signal = %q", content)
+	}
+
+	//no reopen after close
+	l.Close()
+	os.Remove(file)
+	if err := l.Reopen(); err != nil || logFileExists(file) {
+		t.Errorf("Reopen after close err = %v, file exists %v", err, logFileExists(file))
+	}
+}
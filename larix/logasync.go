@@ -0,0 +1,214 @@
+package larix
+
+/**
+ * async log writer, lines are put into a bounded buffer and written by a
+ * background goroutine, so callers don't wait for disk
+ *
+ * when buffer is full, lines are handled by overflow policy:
+ *	block:   wait for space, default
+ *	drop:    drop the line
+ *	droplow: drop debug, trace and notice lines once buffer is 3/4 full,
+ *	         so warning and fatal lines keep room, they wait for space
+ *
+ * dropped lines are counted, see LogDropped, and reported in wf file when
+ * buffer is drained. LogFlush waits until buffered lines are written,
+ * fatal lines are flushed at once, LogDestory drains buffer before close
+ **/
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//async buffer overflow policy
+const (
+	LOG_OVERFLOW_BLOCK   = "block"
+	LOG_OVERFLOW_DROP    = "drop"
+	LOG_OVERFLOW_DROPLOW = "droplow"
+)
+
+//default async conf
+const (
+	logBufferSize   = 4096
+	logFlushTimeout = 5 * time.Second
+)
+
+type logLine struct {
+	now   time.Time
+	level int
+	line  string
+
+	//flush mark, closed when lines before it are written
+	flushed chan struct{}
+}
+
+type logAsync struct {
+	buffer chan *logLine
+
+	//lines dropped by overflow policy
+	dropped uint64
+
+	//dropped lines already reported, only used by writer goroutine
+	reported uint64
+
+	quit     chan struct{}
+	done     chan struct{}
+	quitOnce sync.Once
+}
+
+// LogFlush see Log.Flush, for default log
+func LogFlush() error {
+	l := logDefault()
+	if l == nil {
+		return nil
+	}
+	return l.Flush()
+}
+
+// LogDropped see Log.Dropped, for default log
+func LogDropped() uint64 {
+	l := logDefault()
+	if l == nil {
+		return 0
+	}
+	return l.Dropped()
+}
+
+// Flush wait until lines in async buffer are written, at most FlushTimeout
+func (l *Log) Flush() error {
+	a := l.async
+	if a == nil {
+		return nil
+	}
+
+	timer := time.NewTimer(l.FlushTimeout)
+	defer timer.Stop()
+
+	mark := &logLine{flushed: make(chan struct{})}
+	select {
+	case a.buffer <- mark:
+	case <-a.done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("flush log timeout after %s", l.FlushTimeout)
+	}
+
+	select {
+	case <-mark.flushed:
+		return nil
+	case <-a.done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("flush log timeout after %s", l.FlushTimeout)
+	}
+}
+
+// Dropped lines dropped by async overflow policy
+func (l *Log) Dropped() uint64 {
+	if l.async == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&l.async.dropped)
+}
+
+func (l *Log) startAsync() {
+	l.async = &logAsync{
+		buffer: make(chan *logLine, l.BufferSize),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go l.drain()
+}
+
+//stopAsync flush buffer and stop writer goroutine
+func (l *Log) stopAsync() {
+	a := l.async
+	if err := l.Flush(); err != nil {
+		io.WriteString(os.Stderr, "log destory, "+err.Error()+"\n")
+	}
+	a.quitOnce.Do(func() { close(a.quit) })
+
+	timer := time.NewTimer(l.FlushTimeout)
+	defer timer.Stop()
+	select {
+	case <-a.done:
+	case <-timer.C:
+	}
+}
+
+//push put line into buffer by overflow policy
+func (l *Log) push(item *logLine) {
+	a := l.async
+
+	if l.Overflow == LOG_OVERFLOW_DROP || (l.Overflow == LOG_OVERFLOW_DROPLOW && item.level < LOG_WARN) {
+		if l.Overflow == LOG_OVERFLOW_DROPLOW && len(a.buffer) >= cap(a.buffer)*3/4 {
+			atomic.AddUint64(&a.dropped, 1)
+			return
+		}
+		select {
+		case a.buffer <- item:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+		}
+		return
+	}
+
+	select {
+	case a.buffer <- item:
+	case <-a.quit:
+	}
+}
+
+//drain write buffered lines until quit, lines left in buffer are written before exit
+func (l *Log) drain() {
+	a := l.async
+	defer close(a.done)
+
+	for {
+		select {
+		case item := <-a.buffer:
+			l.writeLine(item)
+		case <-a.quit:
+			for {
+				select {
+				case item := <-a.buffer:
+					l.writeLine(item)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *Log) writeLine(item *logLine) {
+	if item.flushed == nil {
+		l.write(item.now, item.level, item.line)
+	}
+
+	//report when buffer drained, and before flush returns
+	if len(l.async.buffer) == 0 || item.flushed != nil {
+		l.reportDropped()
+	}
+	if item.flushed != nil {
+		close(item.flushed)
+	}
+}
+
+//reportDropped write a warning line for lines dropped since last report
+func (l *Log) reportDropped() {
+	a := l.async
+	dropped := atomic.LoadUint64(&a.dropped)
+	if dropped <= a.reported {
+		return
+	}
+
+	now := logNow()
+	msg := fmt.Sprintf("async log buffer full, dropped %d lines", dropped-a.reported)
+	_, caller := logCaller(0)
+	l.write(now, LOG_WARN, l.formatLine(now, logCall{caller: caller}, LOG_WARN, nil, msg))
+	a.reported = dropped
+}
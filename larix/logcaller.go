@@ -0,0 +1,173 @@
+package larix
+
+/**
+ * where and why a line is logged
+ *
+ * with CallerFunc, function name follows file and line:
+ *	2026/10/18 15:04:05 httpclient.go:66 larix.(*HttpClient).Request: [warning] ...
+ * lines at or above StackLevel carry the stack, like stack[main.f(/app/main.go:10) main.main(/app/main.go:5)],
+ * in json they are keys "func" and "stack"
+ *
+ * error params are kept in message, in json and slog they also become fields
+ * by their errors.Unwrap chain, text lines are not changed:
+ *	error         message of the error, omitted when message contains it
+ *	error_causes  messages of wrapped errors, outermost first
+ *	error_type    type of the innermost error
+ * more errors in one line are error_1, error_2 ...
+ *
+ * LogPanic log a panic with stack and panic again, use with defer
+ **/
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//max frames in stack
+const logStackDepth = 32
+
+//logCall where a line is logged
+type logCall struct {
+	//short file and line
+	caller string
+
+	//function name, empty without CallerFunc
+	fn string
+
+	//frames from caller, empty below StackLevel
+	stack []string
+}
+
+// LogPanic use with defer, log the panic at fatal level with stack, and panic again
+//
+//	defer larix.LogPanic()
+func LogPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if l := logDefault(); l != nil {
+		l.logPanic(r)
+	}
+	panic(r)
+}
+
+// Recover same as LogPanic, for this log
+func (l *Log) Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	l.logPanic(r)
+	panic(r)
+}
+
+func (l *Log) logPanic(r interface{}) {
+	now := logNow()
+
+	//skip LogPanic and runtime panic frames, the first one left is where panic happens
+	frames := logFrames(2)
+	for len(frames) > 1 && strings.HasPrefix(frames[0].Function, "runtime.") {
+		frames = frames[1:]
+	}
+
+	call := logCall{caller: "???:0", stack: formatLogFrames(frames)}
+	if len(frames) > 0 {
+		call.caller = filepath.Base(frames[0].File) + ":" + strconv.Itoa(frames[0].Line)
+		if l.CallerFunc {
+			call.fn = shortFuncName(frames[0].Function)
+		}
+	}
+
+	v := []interface{}{"panic: %v", r}
+	l.send(now, LOG_FATAL, l.formatLine(now, call, LOG_FATAL, nil, v...))
+	l.Flush()
+}
+
+//logFuncName short function name at pc, like larix.(*Log).output
+func logFuncName(pc uintptr) string {
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "???"
+	}
+	return shortFuncName(fn.Name())
+}
+
+func shortFuncName(name string) string {
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+//logFrames stack frames, skip is same as logCaller
+func logFrames(skip int) []runtime.Frame {
+	pcs := make([]uintptr, logStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	res := []runtime.Frame{}
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "runtime.goexit" {
+			res = append(res, frame)
+		}
+		if !more {
+			break
+		}
+	}
+	return res
+}
+
+//formatLogFrames frames like pkg.Func(/path/file.go:10)
+func formatLogFrames(frames []runtime.Frame) []string {
+	res := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		res = append(res, shortFuncName(frame.Function)+"("+frame.File+":"+strconv.Itoa(frame.Line)+")")
+	}
+	return res
+}
+
+//logErrorFields fields of error params by unwrap chain, see file comment
+func logErrorFields(msg string, v []interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for i, err := range logErrors(v) {
+		name := "error"
+		if i > 0 {
+			name = "error_" + strconv.Itoa(i)
+		}
+
+		if !strings.Contains(msg, err.Error()) {
+			res[name] = err.Error()
+		}
+		causes := []string{}
+		root := err
+		for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(cause) {
+			causes = append(causes, logErrorString(cause))
+			root = cause
+			//Unwrap of nil pointer may panic
+			if nilLogError(cause) {
+				break
+			}
+		}
+		if len(causes) > 0 {
+			res[name+"_causes"] = causes
+		}
+		res[name+"_type"] = fmt.Sprintf("%T", root)
+	}
+	return res
+}
+
+func logErrors(v []interface{}) []error {
+	res := []error{}
+	for _, val := range v {
+		//nil pointer has nothing to expand
+		if err, ok := val.(error); ok && !nilLogError(err) {
+			res = append(res, err)
+		}
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+package larix
+
+/**
+ * json log line, one object per line, keys in stable order:
+ *	time, level, caller, func, fields sorted by key, msg, args, stack
+ * fields are basic fields, entry fields and map params, later ones win on the
+ * same key, then error fields of error params, see logcaller.go; structs, pointers, slices and arrays in params are encoded in args,
+ * other params are joined into msg, like:
+ *	{"time":"2026-10-18T15:04:05.000+08:00","level":"warning","caller":"httpclient.go:70","method":"POST","msg":"request failed"}
+ **/
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const logJsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+//reserved json keys, fields with same name are prefixed by "fields."
+var logJsonReserved = map[string]bool{
+	"time":   true,
+	"level":  true,
+	"caller": true,
+	"msg":    true,
+	"func":   true,
+	"stack":  true,
+	"args":   true,
+}
+
+func (l *Log) genLogJson(now time.Time, call logCall, level int, entry_fields map[string]interface{}, v ...interface{}) string {
+	msg, params, args := l.splitLogValues(v...)
+
+	var res bytes.Buffer
+	res.WriteString(`{"time":`)
+	res.Write(logJsonValue(now.Format(logJsonTimeFormat)))
+	res.WriteString(`,"level":`)
+	res.Write(logJsonValue(logString[level]))
+	res.WriteString(`,"caller":`)
+	res.Write(logJsonValue(call.caller))
+	if call.fn != "" {
+		res.WriteString(`,"func":`)
+		res.Write(logJsonValue(call.fn))
+	}
+
+	//map fields in params override entry fields, which override basic fields
+	fields := map[string]interface{}{}
+	for key, value := range l.basicFields() {
+		fields[key] = value
+	}
+	for key, value := range entry_fields {
+		fields[key] = value
+	}
+	for key, value := range params {
+		fields[key] = value
+	}
+	for key, value := range logErrorFields(msg, v) {
+		if _, exists := fields[key]; !exists {
+			fields[key] = value
+		}
+	}
+	writeLogJsonFields(&res, fields)
+
+	res.WriteString(`,"msg":`)
+	res.Write(logJsonValue(msg))
+	if len(args) > 0 {
+		res.WriteString(`,"args":`)
+		res.Write(logJsonValue(args))
+	}
+	if len(call.stack) > 0 {
+		res.WriteString(`,"stack":`)
+		res.Write(logJsonValue(call.stack))
+	}
+	res.WriteString("}\n")
+
+	return res.String()
+}
+
+//splitLogValues take map params as fields, structs, pointers, slices and arrays
+//as args, other params are joined into msg in the same way as text format
+func (l *Log) splitLogValues(v ...interface{}) (string, map[string]interface{}, []interface{}) {
+	fields := map[string]interface{}{}
+	args := []interface{}{}
+
+	if len(v) >= 2 {
+		if format_str, ok := v[0].(string); ok {
+			return strings.TrimSpace(fmt.Sprintf(format_str, v[1:]...)), fields, args
+		}
+	}
+
+	msg := []string{}
+	for _, val := range v {
+		//errors are pointers mostly, keep their text in msg
+		if _, ok := val.(error); ok {
+			msg = append(msg, strings.TrimSpace(l.dealFields(val)))
+			continue
+		}
+
+		value := reflect.ValueOf(val)
+		switch value.Kind() {
+		case reflect.Map:
+			iter := value.MapRange()
+			for iter.Next() {
+				fields[fmt.Sprintf("%v", iter.Key())] = iter.Value().Interface()
+			}
+		case reflect.Struct, reflect.Ptr, reflect.Slice, reflect.Array:
+			args = append(args, val)
+		default:
+			msg = append(msg, strings.TrimSpace(l.dealFields(val)))
+		}
+	}
+	return strings.Join(msg, " "), fields, args
+}
+
+func writeLogJsonFields(res *bytes.Buffer, fields map[string]interface{}) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := key
+		if logJsonReserved[name] {
+			name = "fields." + name
+		}
+		res.WriteString(",")
+		res.Write(logJsonValue(name))
+		res.WriteString(":")
+		res.Write(logJsonValue(fields[key]))
+	}
+}
+
+//logJsonValue encode value as json, structs, slices and pointers are
+//encoded by encoding/json, values it can't encode are kept as %+v string
+func logJsonValue(v interface{}) []byte {
+	if err, ok := v.(error); ok {
+		v = logErrorString(err)
+	}
+
+	var res bytes.Buffer
+	encoder := json.NewEncoder(&res)
+	//keep <, > and & readable in log
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		res.Reset()
+		encoder.Encode(fmt.Sprintf("%+v", v))
+	}
+	return bytes.TrimRight(res.Bytes(), "\n")
+}
+
+//logErrorString message of err, "<nil>" like fmt for nil pointer, whose Error may panic
+func logErrorString(err error) string {
+	if nilLogError(err) {
+		return "<nil>"
+	}
+	return err.Error()
+}
+
+//nilLogError nil or nil pointer error
+func nilLogError(err error) bool {
+	value := reflect.ValueOf(err)
+	return !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil())
+}
@@ -0,0 +1,105 @@
+package larix
+
+/**
+ * Entry carry extra fields on every log line, like request id:
+ *
+ *	entry := larix.LogWith(map[string]interface{}{"req_id": id})
+ *	ctx = larix.LogNewContext(ctx, entry)
+ *	...
+ *	larix.LogFromContext(ctx).Notice("order created")
+ *
+ * entry fields are put after basic fields, level and output follow its Log
+ **/
+import (
+	"context"
+)
+
+// Entry a logger with extra fields
+type Entry struct {
+	//nil for default log handler, looked up when writing
+	log *Log
+
+	//must not be modified after creation, use With to add fields
+	Fields map[string]interface{}
+}
+
+type logContextKey struct{}
+
+// LogWith create an entry with fields on default log handler
+func LogWith(fields map[string]interface{}) *Entry {
+	return (&Entry{}).With(fields)
+}
+
+// LogNewContext return a copy of ctx carrying entry
+func LogNewContext(ctx context.Context, entry *Entry) context.Context {
+	return context.WithValue(ctx, logContextKey{}, entry)
+}
+
+// LogFromContext get entry in ctx, an entry without fields when not found
+func LogFromContext(ctx context.Context) *Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(logContextKey{}).(*Entry); ok && entry != nil {
+			return entry
+		}
+	}
+	return &Entry{}
+}
+
+// With create an entry with fields on l
+func (l *Log) With(fields map[string]interface{}) *Entry {
+	return (&Entry{log: l}).With(fields)
+}
+
+// With create a child entry with fields added, same keys are replaced
+func (e *Entry) With(fields map[string]interface{}) *Entry {
+	res := &Entry{
+		log:    e.log,
+		Fields: make(map[string]interface{}, len(e.Fields)+len(fields)),
+	}
+	for key, value := range e.Fields {
+		res.Fields[key] = value
+	}
+	for key, value := range fields {
+		res.Fields[key] = value
+	}
+	return res
+}
+
+func (e *Entry) Debug(v ...interface{}) {
+	e.write(LOG_DEBUG, v...)
+}
+
+func (e *Entry) Trace(v ...interface{}) {
+	e.write(LOG_TRACE, v...)
+}
+
+func (e *Entry) Notice(v ...interface{}) {
+	e.write(LOG_NOTICE, v...)
+}
+
+func (e *Entry) Warn(v ...interface{}) {
+	e.write(LOG_WARN, v...)
+}
+
+func (e *Entry) Fatal(v ...interface{}) {
+	e.write(LOG_FATAL, v...)
+}
+
+func (e *Entry) write(level int, v ...interface{}) {
+	l := e.log
+	if l == nil {
+		if logToSlog(2, level, e.Fields, v...) {
+			return
+		}
+		l = logDefault()
+	}
+	if l == nil {
+		return
+	}
+
+	if !l.enabled(level) {
+		return
+	}
+
+	l.output(3, level, e.Fields, v...)
+}
@@ -0,0 +1,293 @@
+package larix
+
+/**
+ * runtime log level
+ *
+ * level is changed at runtime by LogSetLevel, modules may have their own
+ * level by package path prefix, the longest prefix wins:
+ *
+ *	larix.LogSetModuleLevel("github.com/kstrwind/lib-go/sdk/zabbix", larix.LOG_DEBUG)
+ *
+ * in conf, level is a name or number, modules like "sdk/zabbix:debug, main:warning"
+ *
+ * LogLevelHandler shows and changes levels by http:
+ *
+ *	GET                              {"level":"notice","modules":{"main":"debug"}}
+ *	POST   level=debug[&module=main] set level of log or module
+ *	DELETE module=main               remove module level
+ **/
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevel level in conf, by name like "warning" or number
+type LogLevel int
+
+// UnmarshalText parse level by ParseLogLevel
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLogLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = LogLevel(level)
+	return nil
+}
+
+// String name of level
+func (l LogLevel) String() string {
+	if name, exists := logString[int(l)]; exists {
+		return name
+	}
+	return strconv.Itoa(int(l))
+}
+
+// ParseLogLevel level by name like "debug" and "warning", or number
+func ParseLogLevel(name string) (int, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for level, str := range logString {
+		if str == name {
+			return level, nil
+		}
+	}
+
+	level, err := strconv.Atoi(name)
+	if err != nil || level < LOG_DEBUG || level >= LOG_OVER {
+		return 0, fmt.Errorf("log level [%s] invalid", name)
+	}
+	return level, nil
+}
+
+// LogSetLevel see Log.SetLevel, for default log
+func LogSetLevel(level int) error {
+	l := logDefault()
+	if l == nil {
+		return nil
+	}
+	return l.SetLevel(level)
+}
+
+// LogGetLevel see Log.GetLevel, for default log
+func LogGetLevel() int {
+	l := logDefault()
+	if l == nil {
+		return LOG_DEBUG
+	}
+	return l.GetLevel()
+}
+
+// LogSetModuleLevel see Log.SetModuleLevel, for default log
+func LogSetModuleLevel(module string, level int) error {
+	l := logDefault()
+	if l == nil {
+		return nil
+	}
+	return l.SetModuleLevel(module, level)
+}
+
+// LogRmModuleLevel see Log.RmModuleLevel, for default log
+func LogRmModuleLevel(module string) {
+	if l := logDefault(); l != nil {
+		l.RmModuleLevel(module)
+	}
+}
+
+// LogLevelHandler see Log.LevelHandler, for default log
+func LogLevelHandler() http.Handler {
+	return &logLevelHandler{}
+}
+
+// SetLevel change level, safe to call while logging
+func (l *Log) SetLevel(level int) error {
+	if level < LOG_DEBUG || level >= LOG_OVER {
+		return fmt.Errorf("log level [%d] invalid", level)
+	}
+
+	l.moduleMu.Lock()
+	defer l.moduleMu.Unlock()
+	atomic.StoreInt32(&l.level, int32(level))
+	l.updateMinLevel()
+	return nil
+}
+
+// GetLevel current level
+func (l *Log) GetLevel() int {
+	return int(atomic.LoadInt32(&l.level))
+}
+
+// SetModuleLevel set level of lines logged by functions in module,
+// module is a package path or its prefix
+func (l *Log) SetModuleLevel(module string, level int) error {
+	if level < LOG_DEBUG || level >= LOG_OVER {
+		return fmt.Errorf("log level [%d] invalid", level)
+	}
+	module = strings.TrimSpace(module)
+	if module == "" {
+		return fmt.Errorf("log module is empty")
+	}
+
+	l.moduleMu.Lock()
+	defer l.moduleMu.Unlock()
+
+	//copy on write, like basic fields
+	modules := l.ModuleLevels()
+	modules[module] = level
+	l.modules.Store(modules)
+	l.updateMinLevel()
+	return nil
+}
+
+// RmModuleLevel remove module level, its lines use log level again
+func (l *Log) RmModuleLevel(module string) {
+	l.moduleMu.Lock()
+	defer l.moduleMu.Unlock()
+
+	modules := l.ModuleLevels()
+	delete(modules, strings.TrimSpace(module))
+	l.modules.Store(modules)
+	l.updateMinLevel()
+}
+
+// ModuleLevels copy of module levels
+func (l *Log) ModuleLevels() map[string]int {
+	res := map[string]int{}
+	for module, level := range l.moduleLevels() {
+		res[module] = level
+	}
+	return res
+}
+
+// LevelHandler http handler to show and change levels, see file comment
+func (l *Log) LevelHandler() http.Handler {
+	return &logLevelHandler{log: l}
+}
+
+func (l *Log) moduleLevels() map[string]int {
+	modules, _ := l.modules.Load().(map[string]int)
+	return modules
+}
+
+//updateMinLevel must be called with moduleMu held
+func (l *Log) updateMinLevel() {
+	min := l.GetLevel()
+	for _, level := range l.moduleLevels() {
+		if level < min {
+			min = level
+		}
+	}
+	atomic.StoreInt32(&l.minLevel, int32(min))
+}
+
+//enabled fast check before caller is known, lines may still be dropped by levelOf
+func (l *Log) enabled(level int) bool {
+	return level >= int(atomic.LoadInt32(&l.minLevel))
+}
+
+//levelOf level for lines logged at pc, by the longest module prefix of its function
+func (l *Log) levelOf(pc uintptr) int {
+	modules := l.moduleLevels()
+	if len(modules) == 0 || pc == 0 {
+		return l.GetLevel()
+	}
+
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return l.GetLevel()
+	}
+	name := fn.Name()
+
+	res, matched := l.GetLevel(), ""
+	for module, level := range modules {
+		if len(module) <= len(matched) || !strings.HasPrefix(name, module) {
+			continue
+		}
+		//whole path element, "a/b" not match "a/bc.Func"
+		if len(name) > len(module) && name[len(module)] != '.' && name[len(module)] != '/' {
+			continue
+		}
+		res, matched = level, module
+	}
+	return res
+}
+
+//parseModuleLevels modules like "sdk/zabbix:debug, main:warning"
+func parseModuleLevels(modules string) (map[string]int, error) {
+	res := map[string]int{}
+	for _, item := range strings.Split(modules, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		pair := strings.SplitN(item, ":", 2)
+		module := strings.TrimSpace(pair[0])
+		if len(pair) != 2 || module == "" {
+			return nil, fmt.Errorf("log module level [%s] invalid", strings.TrimSpace(item))
+		}
+		level, err := ParseLogLevel(pair[1])
+		if err != nil {
+			return nil, err
+		}
+		res[module] = level
+	}
+	return res, nil
+}
+
+type logLevelHandler struct {
+	//nil for default log
+	log *Log
+}
+
+type logLevelState struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+}
+
+func (h *logLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l := h.log
+	if l == nil {
+		l = logDefault()
+	}
+	if l == nil {
+		http.Error(w, "log not init", http.StatusServiceUnavailable)
+		return
+	}
+
+	module := r.FormValue("module")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		level, err := ParseLogLevel(r.FormValue("level"))
+		if err == nil {
+			if module == "" {
+				err = l.SetLevel(level)
+			} else {
+				err = l.SetModuleLevel(module, level)
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		if module == "" {
+			http.Error(w, "module is required", http.StatusBadRequest)
+			return
+		}
+		l.RmModuleLevel(module)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state := logLevelState{Level: LogLevel(l.GetLevel()).String(), Modules: map[string]string{}}
+	for module, level := range l.moduleLevels() {
+		state.Modules[module] = LogLevel(level).String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
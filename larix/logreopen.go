@@ -0,0 +1,123 @@
+package larix
+
+/**
+ * reopen log files, for external logrotate which moves files away:
+ *	/path/to/logs/app.log {
+ *		daily
+ *		rotate 7
+ *		postrotate
+ *			kill -USR1 $(cat /path/to/app.pid)
+ *		endscript
+ *	}
+ * files are reopened by current names, lines written between move and reopen
+ * go to the moved files; sinks are not reopened
+ **/
+import (
+	"io"
+	"os"
+	"os/signal"
+)
+
+type logReopen struct {
+	signals chan os.Signal
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// LogReopen reopen files of default log
+func LogReopen() error {
+	if l := logDefault(); l != nil {
+		return l.Reopen()
+	}
+	return nil
+}
+
+// LogReopenOnSignal reopen files of default log on signals, SIGUSR1 by default
+func LogReopenOnSignal(sigs ...os.Signal) {
+	if l := logDefault(); l != nil {
+		l.ReopenOnSignal(sigs...)
+	}
+}
+
+// Reopen close current files and open them again by name, old files are
+// kept when new ones can't be opened
+func (l *Log) Reopen() error {
+	if l.File == "" {
+		return nil
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	suffix := l.currSuffix
+	nfd, wfd, err := l.openFiles(suffix)
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	old_nfd, old_wfd := l.swapFiles(suffix, nfd, wfd)
+	l.mu.Unlock()
+
+	old_nfd.Close()
+	old_wfd.Close()
+	return nil
+}
+
+// ReopenOnSignal reopen files on signals, SIGUSR1 by default, it replaces
+// signals set before and stops when log closed
+func (l *Log) ReopenOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = logReopenSignals
+	}
+	//signal.Notify without signals relays all of them
+	if len(sigs) == 0 {
+		return
+	}
+
+	r := &logReopen{
+		signals: make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	signal.Notify(r.signals, sigs...)
+
+	l.reopenMu.Lock()
+	old := l.reopen
+	l.reopen = r
+	l.reopenMu.Unlock()
+	if old != nil {
+		old.close()
+	}
+
+	go func() {
+		defer close(r.done)
+		for {
+			select {
+			case <-r.signals:
+				if err := l.Reopen(); err != nil {
+					io.WriteString(os.Stderr, "log reopen failed, keep writing to old files, "+err.Error()+"\n")
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (l *Log) stopReopen() {
+	l.reopenMu.Lock()
+	r := l.reopen
+	l.reopen = nil
+	l.reopenMu.Unlock()
+	if r != nil {
+		r.close()
+	}
+}
+
+func (r *logReopen) close() {
+	signal.Stop(r.signals)
+	close(r.stop)
+	<-r.done
+}
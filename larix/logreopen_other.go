@@ -0,0 +1,8 @@
+//go:build !unix
+
+package larix
+
+import "os"
+
+//no SIGUSR1, ReopenOnSignal needs signals given
+var logReopenSignals = []os.Signal{}
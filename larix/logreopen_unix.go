@@ -0,0 +1,11 @@
+//go:build unix
+
+package larix
+
+import (
+	"os"
+	"syscall"
+)
+
+//default signals of ReopenOnSignal
+var logReopenSignals = []os.Signal{syscall.SIGUSR1}
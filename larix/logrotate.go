@@ -0,0 +1,445 @@
+package larix
+
+/**
+ * log rotate, files are named by rotate policy:
+ *	hour:  File.YYYYMMDDHH      File.wf.YYYYMMDDHH
+ *	day:   File.YYYYMMDD        File.wf.YYYYMMDD
+ *	size:  File.YYYYMMDDHHMMSS  File.wf.YYYYMMDDHHMMSS, when any file reach MaxSize
+ * rotated files may be gzipped to File.xxx.gz, and are removed by
+ * MaxBackups and MaxAge; with Symlink, File and File.wf always point to
+ * current files, so tail -F keeps working;
+ * files and missing dirs are created with FileMode, DirMode and Owner
+ **/
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//log rotate policy
+const (
+	LOG_ROTATE_HOUR = "hour"
+	LOG_ROTATE_DAY  = "day"
+	LOG_ROTATE_SIZE = "size"
+)
+
+//time source, replaced in tests
+var logNow = time.Now
+
+//wait before next try when rotate failed
+const logRotateRetry = time.Second
+
+//default permission of created log files and dirs
+const (
+	logFileMode os.FileMode = 0640
+	logDirMode  os.FileMode = 0755
+)
+
+//rotateSign current sign by policy, size policy not rotate by time
+func (l *Log) rotateSign(t_case time.Time) int {
+	switch l.RotateBy {
+	case LOG_ROTATE_DAY:
+		return t_case.Year()*10000 + int(t_case.Month())*100 + t_case.Day()
+	case LOG_ROTATE_SIZE:
+		return 0
+	}
+	return t_case.Year()*1000000 + int(t_case.Month())*10000 + t_case.Day()*100 + t_case.Hour()
+}
+
+//nextSuffix suffix of files after rotate
+func (l *Log) nextSuffix(now time.Time) string {
+	if l.RotateBy != LOG_ROTATE_SIZE {
+		return strconv.Itoa(l.rotateSign(now))
+	}
+
+	//rotate more than once a second
+	suffix := now.Format("20060102150405")
+	res := suffix
+	for i := 1; ; i++ {
+		nlfile, wlfile := l.logFiles(res)
+		if !logFileExists(nlfile) && !logFileExists(wlfile) && !logFileExists(nlfile+".gz") {
+			return res
+		}
+		res = fmt.Sprintf("%s.%d", suffix, i)
+	}
+}
+
+func logFileExists(file string) bool {
+	_, err := os.Lstat(file)
+	return err == nil
+}
+
+//logFiles normal and wf file names with suffix
+func (l *Log) logFiles(suffix string) (string, string) {
+	if suffix == "" {
+		return l.File, l.File + ".wf"
+	}
+	return l.File + "." + suffix, l.File + ".wf." + suffix
+}
+
+//needRotate must be called with l.mu held, rotate sign only goes forward,
+//so a writer with an earlier time never rotates back
+func (l *Log) needRotate(now time.Time) bool {
+	if !l.Rotate || l.closed || now.Before(l.rotateRetry) {
+		return false
+	}
+	if l.RotateBy == LOG_ROTATE_SIZE {
+		return atomic.LoadInt64(&l.nsize) >= l.MaxSize || atomic.LoadInt64(&l.wsize) >= l.MaxSize
+	}
+	return l.rotateSign(now) > l.CurrRotateSign
+}
+
+//rotate switch to new files, new files are opened before old ones are closed,
+//writers hold the read lock, so no line goes to a closed file;
+//if new files can't be opened, we keep writing to old ones and retry later
+func (l *Log) rotate(now time.Time) {
+	l.mu.RLock()
+	need := l.needRotate(now)
+	l.mu.RUnlock()
+	if !need {
+		return
+	}
+
+	l.mu.Lock()
+	//another writer may rotate before we get the lock
+	if !l.needRotate(now) {
+		l.mu.Unlock()
+		return
+	}
+
+	suffix := l.nextSuffix(now)
+	nfd, wfd, err := l.openFiles(suffix)
+	if err != nil {
+		l.rotateRetry = now.Add(logRotateRetry)
+		l.mu.Unlock()
+		io.WriteString(os.Stderr, "log rotate failed, keep writing to old files, "+err.Error()+"\n")
+		return
+	}
+
+	old_nfd, old_wfd := l.swapFiles(suffix, nfd, wfd)
+	//when rotate done, we change the sign ,for we can reentrant
+	l.CurrRotateSign = l.rotateSign(now)
+	//counted before unlock, so Close never misses it
+	need_cleanup := l.Compress || l.MaxBackups > 0 || l.MaxAge > 0
+	if need_cleanup {
+		l.cleanupWg.Add(1)
+	}
+	l.mu.Unlock()
+
+	//no writer uses old files after swap
+	if old_nfd != nil {
+		old_nfd.Close()
+	}
+	if old_wfd != nil {
+		old_wfd.Close()
+	}
+
+	if need_cleanup {
+		go func() {
+			defer l.cleanupWg.Done()
+			l.cleanup()
+		}()
+	}
+}
+
+//openFiles open normal and wf log files with suffix
+func (l *Log) openFiles(suffix string) (*os.File, *os.File, error) {
+	nlfile, wlfile := l.logFiles(suffix)
+
+	nfd, err := l.openLogFile(nlfile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open log file %s failed, %s", nlfile, err.Error())
+	}
+
+	wfd, err := l.openLogFile(wlfile)
+	if err != nil {
+		nfd.Close()
+		return nil, nil, fmt.Errorf("open wflog file %s failed, %s", wlfile, err.Error())
+	}
+	return nfd, wfd, nil
+}
+
+//swapFiles use opened files and add log handler, return old files,
+//must be called with l.mu held
+func (l *Log) swapFiles(suffix string, nfd *os.File, wfd *os.File) (*os.File, *os.File) {
+	old_nfd, old_wfd := l.nfd, l.wfd
+
+	l.nfd, l.wfd = nfd, wfd
+	atomic.StoreInt64(&l.nsize, logFileSize(nfd))
+	atomic.StoreInt64(&l.wsize, logFileSize(wfd))
+	l.currSuffix = suffix
+
+	// normal Log Handler, line header is built by ourselves
+	l.nlog = log.New(l.nfd, "", 0)
+
+	// wrong log Handler
+	l.wlog = log.New(l.wfd, "", 0)
+
+	if suffix != "" && l.Symlink {
+		nlfile, wlfile := l.logFiles(suffix)
+		updateLogSymlink(l.File, nlfile)
+		updateLogSymlink(l.File+".wf", wlfile)
+	}
+	return old_nfd, old_wfd
+}
+
+//openLogFile open file for append, missing dirs are created with DirMode,
+//created dirs and files get mode and owner by conf, whatever umask is
+func (l *Log) openLogFile(file string) (*os.File, error) {
+	if err := l.makeLogDir(filepath.Dir(file)); err != nil {
+		return nil, err
+	}
+
+	created := !logFileExists(file)
+	fd, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, l.FileMode)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		if err := l.setLogFileMode(fd.Name(), l.FileMode); err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+	return fd, nil
+}
+
+func (l *Log) makeLogDir(dir string) error {
+	//dirs to create, deepest first
+	missing := []string{}
+	for curr := dir; !logFileExists(curr); curr = filepath.Dir(curr) {
+		missing = append(missing, curr)
+		if filepath.Dir(curr) == curr {
+			break
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, l.DirMode); err != nil {
+		return fmt.Errorf("create log dir failed, %s", err.Error())
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := l.setLogFileMode(missing[i], l.DirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Log) setLogFileMode(file string, mode os.FileMode) error {
+	if err := os.Chmod(file, mode); err != nil {
+		return fmt.Errorf("chmod log file failed, %s", err.Error())
+	}
+	if l.Owner == "" {
+		return nil
+	}
+	if err := os.Lchown(file, l.uid, l.gid); err != nil {
+		return fmt.Errorf("chown log file failed, %s", err.Error())
+	}
+	return nil
+}
+
+//parseLogMode parse octal permission like "0640"
+func parseLogMode(mode string) (os.FileMode, error) {
+	res, err := strconv.ParseUint(strings.TrimSpace(mode), 8, 32)
+	if err != nil || os.FileMode(res)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("log mode %s invalid", mode)
+	}
+	return os.FileMode(res), nil
+}
+
+//parseLogOwner parse "user:group", names or ids, -1 for part not set
+func parseLogOwner(owner string) (int, int, error) {
+	uid, gid := -1, -1
+	pair := strings.SplitN(owner, ":", 2)
+
+	if name := strings.TrimSpace(pair[0]); name != "" {
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return -1, -1, fmt.Errorf("log owner %s invalid, %s", owner, err.Error())
+			}
+			id, _ = strconv.Atoi(u.Uid)
+		}
+		uid = id
+	}
+
+	if len(pair) == 2 && strings.TrimSpace(pair[1]) != "" {
+		name := strings.TrimSpace(pair[1])
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return -1, -1, fmt.Errorf("log owner %s invalid, %s", owner, err.Error())
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		gid = id
+	}
+	return uid, gid, nil
+}
+
+func logFileSize(fd *os.File) int64 {
+	info, err := fd.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+//updateLogSymlink point link to target, a regular file at link is never replaced
+func updateLogSymlink(link string, target string) {
+	info, err := os.Lstat(link)
+	if err == nil && info.Mode()&os.ModeSymlink == 0 {
+		io.WriteString(os.Stderr, "log file "+link+" exists and is not a symlink, skip symlink\n")
+		return
+	}
+
+	//rename is atomic, tail -F never sees a missing link
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	err = os.Symlink(filepath.Base(target), tmp)
+	if err == nil {
+		err = os.Rename(tmp, link)
+	}
+	if err != nil {
+		io.WriteString(os.Stderr, "update log symlink "+link+" failed, "+err.Error()+"\n")
+	}
+}
+
+//cleanup compress and remove rotated files
+func (l *Log) cleanup() {
+	l.cleanupMu.Lock()
+	defer l.cleanupMu.Unlock()
+
+	for _, prefix := range []string{l.File + ".wf.", l.File + "."} {
+		files := rotatedLogFiles(prefix)
+
+		//get current suffix after listing files, so a file opened by a later
+		//rotate is never in the list, suffix never comes back once rotated out
+		l.mu.RLock()
+		curr := l.currSuffix
+		l.mu.RUnlock()
+		files = excludeLogSuffix(files, prefix, curr)
+
+		if l.Compress {
+			for i, file := range files {
+				if strings.HasSuffix(file, ".gz") {
+					continue
+				}
+				if err := l.gzipLogFile(file); err != nil {
+					io.WriteString(os.Stderr, "compress log file "+file+" failed, "+err.Error()+"\n")
+					continue
+				}
+				files[i] = file + ".gz"
+			}
+		}
+
+		//newest first
+		type backup struct {
+			file  string
+			mtime time.Time
+		}
+		backups := []backup{}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			backups = append(backups, backup{file, info.ModTime()})
+		}
+		sort.Slice(backups, func(i, j int) bool {
+			if backups[i].mtime.Equal(backups[j].mtime) {
+				return backups[i].file > backups[j].file
+			}
+			return backups[i].mtime.After(backups[j].mtime)
+		})
+
+		for i, item := range backups {
+			if (l.MaxBackups > 0 && i >= l.MaxBackups) || (l.MaxAge > 0 && logNow().Sub(item.mtime) > l.MaxAge) {
+				os.Remove(item.file)
+			}
+		}
+	}
+}
+
+func excludeLogSuffix(files []string, prefix string, curr string) []string {
+	res := []string{}
+	for _, file := range files {
+		if file != prefix+curr {
+			res = append(res, file)
+		}
+	}
+	return res
+}
+
+//rotatedLogFiles files like prefix + suffix, not symlinks
+func rotatedLogFiles(prefix string) []string {
+	matches, _ := filepath.Glob(prefix + "*")
+
+	res := []string{}
+	for _, file := range matches {
+		suffix := strings.TrimPrefix(file, prefix)
+		//File.wf.xxx also match File.xxx prefix
+		if suffix == "" || suffix[0] < '0' || suffix[0] > '9' {
+			continue
+		}
+		info, err := os.Lstat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		res = append(res, file)
+	}
+	return res
+}
+
+func (l *Log) gzipLogFile(file string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(file+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, l.FileMode)
+	if err != nil {
+		return err
+	}
+	if err := l.setLogFileMode(dst.Name(), l.FileMode); err != nil {
+		dst.Close()
+		os.Remove(file + ".gz")
+		return err
+	}
+
+	writer := gzip.NewWriter(dst)
+	_, err = io.Copy(writer, src)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+	if err != nil {
+		os.Remove(file + ".gz")
+		return err
+	}
+
+	//keep mtime for MaxAge
+	if info, err := src.Stat(); err == nil {
+		os.Chtimes(file+".gz", info.ModTime(), info.ModTime())
+	}
+	return os.Remove(file)
+}
@@ -0,0 +1,141 @@
+package larix
+
+/**
+ * log sampling, protect disks from log floods like retries of a dead server
+ *
+ * lines are counted by key every second, key is the callsite by default,
+ * or the message (format string) with SampleBy "message"; for each key,
+ * the first SampleFirst lines in a second are logged, then 1 in every
+ * SampleThereafter, 0 for none
+ *
+ * suppressed lines are reported by a warning line every SampleReport:
+ *	[warning] log sampling suppressed 120 lines in last 1m0s
+ **/
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//sample key policy
+const (
+	LOG_SAMPLE_CALLER  = "caller"
+	LOG_SAMPLE_MESSAGE = "message"
+)
+
+//default interval of suppressed lines report
+const logSampleReport = time.Minute
+
+type logSampleKey struct {
+	level int
+	pc    uintptr
+	msg   string
+}
+
+type logSampleCounter struct {
+	start time.Time
+	count int
+}
+
+type logSampler struct {
+	mu         sync.Mutex
+	counters   map[logSampleKey]*logSampleCounter
+	suppressed uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (l *Log) startSampler() {
+	l.sampler = &logSampler{
+		counters: map[logSampleKey]*logSampleCounter{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go l.reportSampled()
+}
+
+//stopSampler stop report goroutine, lines suppressed since last report are reported
+func (l *Log) stopSampler() {
+	close(l.sampler.stop)
+	<-l.sampler.done
+}
+
+//sampled check if line should be logged
+func (l *Log) sampled(now time.Time, level int, pc uintptr, v ...interface{}) bool {
+	s := l.sampler
+	if s == nil {
+		return true
+	}
+
+	key := logSampleKey{level: level, pc: pc}
+	if l.SampleBy == LOG_SAMPLE_MESSAGE && len(v) > 0 {
+		//lines with same format string share key, others fall back to callsite
+		if msg, ok := v[0].(string); ok {
+			key = logSampleKey{level: level, msg: msg}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, exists := s.counters[key]
+	if !exists {
+		counter = &logSampleCounter{start: now}
+		s.counters[key] = counter
+	}
+	if now.Sub(counter.start) >= time.Second || now.Before(counter.start) {
+		counter.start, counter.count = now, 0
+	}
+	counter.count++
+
+	if counter.count <= l.SampleFirst {
+		return true
+	}
+	if l.SampleThereafter > 0 && (counter.count-l.SampleFirst)%l.SampleThereafter == 0 {
+		return true
+	}
+	s.suppressed++
+	return false
+}
+
+func (l *Log) reportSampled() {
+	s := l.sampler
+	defer close(s.done)
+
+	ticker := time.NewTicker(l.SampleReport)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.reportSuppressed()
+		case <-s.stop:
+			l.reportSuppressed()
+			return
+		}
+	}
+}
+
+func (l *Log) reportSuppressed() {
+	s := l.sampler
+	now := logNow()
+
+	s.mu.Lock()
+	suppressed := s.suppressed
+	s.suppressed = 0
+	//forget idle keys, messages may be endless
+	for key, counter := range s.counters {
+		if now.Sub(counter.start) >= time.Second {
+			delete(s.counters, key)
+		}
+	}
+	s.mu.Unlock()
+
+	if suppressed == 0 {
+		return
+	}
+	_, caller := logCaller(0)
+	msg := fmt.Sprintf("log sampling suppressed %d lines in last %s", suppressed, l.SampleReport)
+	l.send(now, LOG_WARN, l.formatLine(now, logCall{caller: caller}, LOG_WARN, nil, msg))
+}
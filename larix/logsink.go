@@ -0,0 +1,374 @@
+package larix
+
+/**
+ * log sinks, every log line goes to sinks whose level range contains its level
+ *
+ * File makes two routes, levels below warning go to File, others to File.wf,
+ * more sinks are set by LogConf.Sinks, comma separated urls:
+ *
+ *	stdout, stderr
+ *	discard                            drop lines, for tests and benchmarks
+ *	syslog                             local syslog, /dev/log and friends
+ *	syslog:///var/run/syslog?tag=app   local syslog at path
+ *	tcp://host:port, udp://host:port   lines shipped to collector
+ *
+ * syslog and network sinks write in their own goroutine, lines are queued
+ * and dropped when queue is full, so a slow collector never blocks logging
+ * every url takes params level and max, the lowest and highest level to
+ * route, like "tcp://127.0.0.1:5140?level=warning", by name or number
+ * without File and Sinks, all lines go to stdout
+ **/
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogSink output of log lines, line is formatted and ends with "\n"
+type LogSink interface {
+	Write(level int, line string) error
+	Close() error
+}
+
+//timeout of network sinks
+const logNetTimeout = 3 * time.Second
+
+//wait before next dial when network sink failed
+const logNetRetry = time.Second
+
+//max lines queued by a network sink
+const logNetQueue = 1024
+
+//local syslog sockets
+var logSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+//syslog severity by level, facility user
+var logSyslogPriority = map[int]int{
+	LOG_DEBUG:  8 | 7,
+	LOG_TRACE:  8 | 6,
+	LOG_NOTICE: 8 | 5,
+	LOG_WARN:   8 | 4,
+	LOG_FATAL:  8 | 2,
+}
+
+type logRoute struct {
+	sink LogSink
+	name string
+
+	//level range, both included
+	min int
+	max int
+
+	//set after a failure is reported, reset by a success write
+	failed int32
+}
+
+// LogAddSink see Log.AddSink, for default log
+func LogAddSink(sink LogSink, min int, max int) {
+	if l := logDefault(); l != nil {
+		l.AddSink(sink, min, max)
+	}
+}
+
+// AddSink route lines with level in [min, max] to sink, sink is closed by LogDestory
+func (l *Log) AddSink(sink LogSink, min int, max int) {
+	l.addRoute(&logRoute{sink: sink, name: fmt.Sprintf("%T", sink), min: min, max: max})
+}
+
+func (l *Log) addRoute(route *logRoute) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	//copy on write, like basic fields
+	l.routes = append(append([]*logRoute{}, l.routes...), route)
+}
+
+//writeRoutes write line to sinks, must be called with l.mu held
+func (l *Log) writeRoutes(level int, log_str string) {
+	for _, route := range l.routes {
+		if level < route.min || level > route.max {
+			continue
+		}
+
+		err := route.sink.Write(level, log_str)
+		if err == nil {
+			atomic.StoreInt32(&route.failed, 0)
+			continue
+		}
+		//report once until sink recovers
+		if atomic.CompareAndSwapInt32(&route.failed, 0, 1) {
+			io.WriteString(os.Stderr, "log sink "+route.name+" write failed, "+err.Error()+"\n")
+		}
+	}
+}
+
+//closeSinks close sinks except log files
+func (l *Log) closeSinks() {
+	for _, route := range l.routes {
+		route.sink.Close()
+	}
+}
+
+//logFileSink normal or wf file of Log, files are switched by rotate
+type logFileSink struct {
+	l  *Log
+	wf bool
+}
+
+func (s *logFileSink) Write(level int, line string) error {
+	if s.wf {
+		atomic.AddInt64(&s.l.wsize, int64(len(line)))
+		return s.l.wlog.Output(0, line)
+	}
+	atomic.AddInt64(&s.l.nsize, int64(len(line)))
+	return s.l.nlog.Output(0, line)
+}
+
+//Close files are closed by Log
+func (s *logFileSink) Close() error {
+	return nil
+}
+
+type logWriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogWriterSink sink writing lines to w, like os.Stdout and os.Stderr,
+// w is not closed by sink
+func NewLogWriterSink(w io.Writer) LogSink {
+	return &logWriterSink{w: w}
+}
+
+func (s *logWriterSink) Write(level int, line string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.w, line)
+	return err
+}
+
+func (s *logWriterSink) Close() error {
+	return nil
+}
+
+//logConnSink write lines to a connection in its own goroutine,
+//dial when first write or after failure
+type logConnSink struct {
+	network string
+	addrs   []string
+	format  func(level int, line string) string
+
+	//used by write goroutine only
+	conn   net.Conn
+	retry  time.Time
+	failed bool
+
+	queue     chan string
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newLogConnSink(network string, addrs []string, format func(level int, line string) string) *logConnSink {
+	s := &logConnSink{
+		network: network,
+		addrs:   addrs,
+		format:  format,
+		queue:   make(chan string, logNetQueue),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// NewLogNetSink sink shipping lines to collector by tcp or udp,
+// connection is made at first write, and made again after failure
+func NewLogNetSink(network string, addr string) (LogSink, error) {
+	if !strings.HasPrefix(network, "tcp") && !strings.HasPrefix(network, "udp") {
+		return nil, fmt.Errorf("log sink network [%s] not support", network)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("log sink address [%s] invalid, %s", addr, err.Error())
+	}
+	return newLogConnSink(network, []string{addr}, nil), nil
+}
+
+// NewLogSyslogSink sink writing lines to local syslog by unix socket,
+// empty path for the usual syslog sockets, empty tag for program name
+func NewLogSyslogSink(path string, tag string) (LogSink, error) {
+	addrs := logSyslogPaths
+	if path != "" {
+		addrs = []string{path}
+	}
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+
+	pid := os.Getpid()
+	format := func(level int, line string) string {
+		//<PRI>TIMESTAMP TAG[PID]: MSG, hostname is omitted for local syslog
+		return fmt.Sprintf("<%d>%s %s[%d]: %s", logSyslogPriority[level], logNow().Format(time.Stamp), tag, pid, strings.TrimRight(line, "\n"))
+	}
+	return newLogConnSink("unix", addrs, format), nil
+}
+
+//Write queue line, never blocks
+func (s *logConnSink) Write(level int, line string) error {
+	if s.format != nil {
+		line = s.format(level, line)
+	}
+
+	select {
+	case <-s.quit:
+		return fmt.Errorf("log sink closed, line dropped")
+	default:
+	}
+	select {
+	case s.queue <- line:
+		return nil
+	default:
+		return fmt.Errorf("log sink queue full, line dropped")
+	}
+}
+
+func (s *logConnSink) run() {
+	defer close(s.done)
+	for {
+		select {
+		case line := <-s.queue:
+			s.send(line, time.Now().Add(logNetTimeout))
+		case <-s.quit:
+			//lines queued before close, no more than a timeout in all
+			deadline := time.Now().Add(logNetTimeout)
+			for {
+				select {
+				case line := <-s.queue:
+					if time.Now().Before(deadline) {
+						s.send(line, deadline)
+					}
+				default:
+					if s.conn != nil {
+						s.conn.Close()
+						s.conn = nil
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+//send write line to connection, failure is reported once until recovered
+func (s *logConnSink) send(line string, deadline time.Time) {
+	err := s.write(line, deadline)
+	if err == nil {
+		s.failed = false
+		return
+	}
+	if !s.failed {
+		s.failed = true
+		io.WriteString(os.Stderr, "log sink "+s.network+"://"+strings.Join(s.addrs, ",")+" write failed, "+err.Error()+"\n")
+	}
+}
+
+func (s *logConnSink) write(line string, deadline time.Time) error {
+	if s.conn == nil {
+		if time.Now().Before(s.retry) {
+			return fmt.Errorf("log sink not connected, line dropped")
+		}
+		if err := s.dial(time.Until(deadline)); err != nil {
+			s.retry = time.Now().Add(logNetRetry)
+			return err
+		}
+	}
+
+	s.conn.SetWriteDeadline(deadline)
+	_, err := io.WriteString(s.conn, line)
+	if err != nil {
+		//dial again at next write
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *logConnSink) dial(timeout time.Duration) error {
+	var err error
+	for _, addr := range s.addrs {
+		networks := []string{s.network}
+		//syslog listens on datagram or stream socket
+		if s.network == "unix" {
+			networks = []string{"unixgram", "unix"}
+		}
+		for _, network := range networks {
+			var conn net.Conn
+			conn, err = net.DialTimeout(network, addr, timeout)
+			if err == nil {
+				s.conn = conn
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+//Close write queued lines and close connection
+func (s *logConnSink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.quit)
+	})
+	<-s.done
+	return nil
+}
+
+//openLogSink make sink route by url, see file comment
+func openLogSink(spec string) (*logRoute, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("log sink [%s] invalid, %s", spec, err.Error())
+	}
+
+	route := &logRoute{name: spec, min: LOG_DEBUG, max: LOG_FATAL}
+	for name, bound := range map[string]*int{"level": &route.min, "max": &route.max} {
+		value := u.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		level, err := ParseLogLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("log sink [%s] %s [%s] invalid", spec, name, value)
+		}
+		*bound = level
+	}
+
+	switch {
+	case u.Scheme == "" && u.Path == "stdout":
+		route.sink = NewLogWriterSink(os.Stdout)
+	case u.Scheme == "" && u.Path == "stderr":
+		route.sink = NewLogWriterSink(os.Stderr)
+	case u.Scheme == "" && u.Path == "discard":
+		route.sink = NewLogWriterSink(io.Discard)
+	case u.Scheme == "syslog" || (u.Scheme == "" && u.Path == "syslog"):
+		path := ""
+		if u.Scheme != "" {
+			path = u.Path
+		}
+		route.sink, err = NewLogSyslogSink(path, u.Query().Get("tag"))
+	case u.Scheme == "tcp" || u.Scheme == "udp":
+		route.sink, err = NewLogNetSink(u.Scheme, u.Host)
+	default:
+		err = fmt.Errorf("log sink [%s] not support", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
@@ -0,0 +1,226 @@
+package larix
+
+/**
+ * bridge between larix log and log/slog
+ *
+ * slog to larix, lines go through larix rotation, wf split and basic fields:
+ *
+ *	logger := slog.New(larix.NewLogSlogHandler(nil))
+ *	logger.Warn("request failed", "method", "POST")
+ *
+ * larix to slog, package functions like LogNotice forward to the logger,
+ * map params become attrs, other params are joined into message:
+ *
+ *	larix.LogSetSlog(slog.Default())
+ *
+ * levels map as:
+ *	LOG_DEBUG   slog.LevelDebug
+ *	LOG_TRACE   slog.LevelDebug + 2
+ *	LOG_NOTICE  slog.LevelInfo
+ *	LOG_WARN    slog.LevelWarn
+ *	LOG_FATAL   slog.LevelError
+ **/
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+//larix functions forward to, *slog.Logger
+var logSlog atomic.Value
+
+// LogSlogLevel slog level of larix level
+func LogSlogLevel(level int) slog.Level {
+	switch level {
+	case LOG_DEBUG:
+		return slog.LevelDebug
+	case LOG_TRACE:
+		return slog.LevelDebug + 2
+	case LOG_NOTICE:
+		return slog.LevelInfo
+	case LOG_WARN:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// LogLevelFromSlog larix level of slog level, levels between go down
+func LogLevelFromSlog(level slog.Level) int {
+	switch {
+	case level < slog.LevelDebug+2:
+		return LOG_DEBUG
+	case level < slog.LevelInfo:
+		return LOG_TRACE
+	case level < slog.LevelWarn:
+		return LOG_NOTICE
+	case level < slog.LevelError:
+		return LOG_WARN
+	}
+	return LOG_FATAL
+}
+
+// LogSetSlog forward package functions like LogNotice and entries of default
+// log to logger, nil to stop forwarding
+func LogSetSlog(logger *slog.Logger) {
+	logSlog.Store(logger)
+}
+
+//logToSlog forward line to slog logger if set, skip is same as logCaller
+func logToSlog(skip int, level int, fields map[string]interface{}, v ...interface{}) bool {
+	logger, _ := logSlog.Load().(*slog.Logger)
+	if logger == nil {
+		return false
+	}
+
+	ctx := context.Background()
+	s_level := LogSlogLevel(level)
+	if !logger.Enabled(ctx, s_level) {
+		return true
+	}
+
+	var pcs [1]uintptr
+	runtime.Callers(skip+2, pcs[:])
+
+	//message is built same as json format, no log state is used
+	msg, params, args := (*Log)(nil).splitLogValues(v...)
+	for key, value := range fields {
+		if _, exists := params[key]; !exists {
+			params[key] = value
+		}
+	}
+	if len(args) > 0 {
+		params["args"] = args
+	}
+	for key, value := range logErrorFields(msg, v) {
+		if _, exists := params[key]; !exists {
+			params[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	record := slog.NewRecord(logNow(), s_level, msg, pcs[0])
+	for _, key := range keys {
+		record.AddAttrs(slog.Any(key, params[key]))
+	}
+	logger.Handler().Handle(ctx, record)
+	return true
+}
+
+type logSlogHandler struct {
+	//nil for default log
+	log *Log
+
+	//attrs by WithAttrs
+	fields map[string]interface{}
+
+	//groups by WithGroup, like "a.b."
+	prefix string
+}
+
+// NewLogSlogHandler slog handler writing to l, nil for default log,
+// attrs become fields, groups are flattened into keys like "group.key"
+func NewLogSlogHandler(l *Log) slog.Handler {
+	return &logSlogHandler{log: l, fields: map[string]interface{}{}}
+}
+
+func (h *logSlogHandler) target() *Log {
+	if h.log != nil {
+		return h.log
+	}
+	return logDefault()
+}
+
+func (h *logSlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	l := h.target()
+	return l != nil && l.enabled(LogLevelFromSlog(level))
+}
+
+func (h *logSlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	l := h.target()
+	if l == nil {
+		return nil
+	}
+
+	fields := make(map[string]interface{}, len(h.fields)+record.NumAttrs())
+	for key, value := range h.fields {
+		fields[key] = value
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(fields, h.prefix, attr)
+		return true
+	})
+
+	now := record.Time
+	if now.IsZero() {
+		now = logNow()
+	}
+
+	caller := "???:0"
+	var frame runtime.Frame
+	if record.PC != 0 {
+		frame, _ = runtime.CallersFrames([]uintptr{record.PC}).Next()
+		caller = filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+	}
+	//frames from where slog is called
+	stack := func() []runtime.Frame {
+		frames := logFrames(0)
+		for i, item := range frames {
+			if item.File == frame.File && item.Line == frame.Line {
+				return frames[i:]
+			}
+		}
+		return frames
+	}
+
+	l.outputAt(now, record.PC, caller, stack, LogLevelFromSlog(record.Level), fields, record.Message)
+	return nil
+}
+
+func (h *logSlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(map[string]interface{}, len(h.fields)+len(attrs))
+	for key, value := range h.fields {
+		fields[key] = value
+	}
+	for _, attr := range attrs {
+		addSlogAttr(fields, h.prefix, attr)
+	}
+	return &logSlogHandler{log: h.log, fields: fields, prefix: h.prefix}
+}
+
+func (h *logSlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &logSlogHandler{log: h.log, fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+//addSlogAttr put attr into fields, groups are flattened
+func addSlogAttr(fields map[string]interface{}, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() != slog.KindGroup {
+		fields[prefix+attr.Key] = attr.Value.Any()
+		return
+	}
+
+	//inline group without key
+	group := prefix
+	if attr.Key != "" {
+		group += attr.Key + "."
+	}
+	for _, item := range attr.Value.Group() {
+		addSlogAttr(fields, group, item)
+	}
+}
@@ -0,0 +1,177 @@
+package logtest
+
+/**
+ * in memory larix log for tests, no file is written
+ *
+ *	func Test_Request(t *testing.T) {
+ *		logs := logtest.Install(t)
+ *		...
+ *		logs.AssertLogged(t, larix.LOG_WARN, "http request failed")
+ *	}
+ *
+ * Install replaces larix default log until test ends, for code with its own
+ * log, pass Logger.Log to it. Entries are captured at all levels
+ **/
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kstrwind/lib-go/larix"
+)
+
+// Entry a captured log line
+type Entry struct {
+	Time    time.Time
+	Level   int
+	Message string
+	Caller  string
+	//map params, entry fields, basic fields and error fields
+	Fields map[string]interface{}
+}
+
+// String like a text log line, for test failure messages
+func (e Entry) String() string {
+	return fmt.Sprintf("%s [%s] %s %v", e.Caller, larix.LogLevel(e.Level), e.Message, e.Fields)
+}
+
+// Logger capturing larix log
+type Logger struct {
+	// log writing to this logger
+	Log *larix.Log
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// New capturing logger, it's not the default log, close it by Log.Close
+func New() *Logger {
+	l, err := larix.NewLog(&larix.LogConf{Format: larix.LOG_FORMAT_JSON, Level: larix.LOG_DEBUG, Sinks: "discard"})
+	if err != nil {
+		//discard sink never fails
+		panic(err)
+	}
+
+	c := &Logger{Log: l}
+	l.AddSink(c, larix.LOG_DEBUG, larix.LOG_FATAL)
+	return c
+}
+
+// Install capturing logger as larix default log, old default log is back when test ends
+func Install(t testing.TB) *Logger {
+	t.Helper()
+
+	c := New()
+	old := larix.LogSetDefault(c.Log)
+	t.Cleanup(func() {
+		larix.LogSetDefault(old)
+		c.Log.Close()
+	})
+	return c
+}
+
+// Write implement larix.LogSink, line is json
+func (c *Logger) Write(level int, line string) error {
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewBufferString(line))
+	//keep numbers as they are logged
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return err
+	}
+
+	entry := Entry{Level: level, Fields: map[string]interface{}{}}
+	for key, value := range values {
+		str, _ := value.(string)
+		switch key {
+		case "time":
+			entry.Time, _ = time.Parse("2006-01-02T15:04:05.000Z07:00", str)
+		case "level":
+		case "msg":
+			entry.Message = str
+		case "caller":
+			entry.Caller = str
+		default:
+			entry.Fields[key] = value
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, entry)
+	return nil
+}
+
+// Close implement larix.LogSink, entries are kept
+func (c *Logger) Close() error {
+	return nil
+}
+
+// Entries captured entries in order
+func (c *Logger) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Entry{}, c.entries...)
+}
+
+// Reset forget captured entries
+func (c *Logger) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// Find entries at level, and with substr in message or a field value
+func (c *Logger) Find(level int, substr string) []Entry {
+	res := []Entry{}
+	for _, entry := range c.Entries() {
+		if entry.Level == level && entry.contains(substr) {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+// AssertLogged fail the test if no entry at level with substr, see Find
+func (c *Logger) AssertLogged(t testing.TB, level int, substr string) bool {
+	t.Helper()
+	if len(c.Find(level, substr)) > 0 {
+		return true
+	}
+	t.Errorf("no [%s] log contains %q, logged:\n%s", larix.LogLevel(level), substr, c.dump())
+	return false
+}
+
+// AssertNotLogged fail the test if any entry at level with substr, see Find
+func (c *Logger) AssertNotLogged(t testing.TB, level int, substr string) bool {
+	t.Helper()
+	if len(c.Find(level, substr)) == 0 {
+		return true
+	}
+	t.Errorf("[%s] log contains %q, logged:\n%s", larix.LogLevel(level), substr, c.dump())
+	return false
+}
+
+func (e Entry) contains(substr string) bool {
+	if strings.Contains(e.Message, substr) {
+		return true
+	}
+	for _, value := range e.Fields {
+		if strings.Contains(fmt.Sprintf("%v", value), substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Logger) dump() string {
+	lines := []string{}
+	for _, entry := range c.Entries() {
+		lines = append(lines, "\t"+entry.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -7,16 +7,16 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"zabbix/sync_worker/global"
 
 	"github.com/kstrwind/lib-go/larix"
 )
 
 // ZBX default configure set
 const (
-	ZBXTimeOutMS    int64  = 2000
-	ZBXJSONVersion  string = "2.0"
-	ZBXDefaultRetry uint32 = 3
+	ZBXTimeOutMS       int64  = 2000
+	ZBXJSONVersion     string = "2.0"
+	ZBXDefaultRetry    uint32 = 3
+	ZBXRetryIntervalMS int64  = 1000
 )
 
 // ZBXHeaders set default zabbix headers
@@ -27,29 +27,32 @@ var ZBXHeaders = map[string]string{
 
 // ZBXConf define a conf fields map for conf to decode
 type ZBXConf struct {
-	IP             string `ini:"ip"`
-	Port           int    `ini:"port"`
-	URI            string `ini:"uri"`
-	User           string `ini:"user"`
-	Passwd         string `ini:"passwd"`
-	Headers        string `ini:"headers"`
-	BaseTemplateID string `ini:"base_template_id"`
-	TimeOutMs      int64  `ini:"timeout_ms"`
+	IP              string `ini:"ip"`
+	Port            int    `ini:"port"`
+	URI             string `ini:"uri"`
+	User            string `ini:"user"`
+	Passwd          string `ini:"passwd"`
+	Headers         string `ini:"headers"`
+	BaseTemplateID  string `ini:"base_template_id"`
+	TimeOutMs       int64  `ini:"timeout_ms"`
+	RetryIntervalMs int64  `ini:"retry_interval_ms"`
 }
 
 // ZBXClient define for create a new ZBXClient
 type ZBXClient struct {
-	IP             string            `json:"ip"`
-	Port           int               `json:"port"`
-	URI            string            `json:"uri"`
-	User           string            `json:"user"`
-	Passwd         string            `json:"passwd"`
-	TimeOutMs      int64             `json:"timeout"`
-	Headers        map[string]string `json:"headers"`
-	sessionid      string
-	httpClient     *larix.HttpClient
-	id             int    //req id
-	BaseTemplateID string `json:"_"`
+	IP              string            `json:"ip"`
+	Port            int               `json:"port"`
+	URI             string            `json:"uri"`
+	User            string            `json:"user"`
+	Passwd          string            `json:"passwd"`
+	TimeOutMs       int64             `json:"timeout"`
+	RetryIntervalMs int64             `json:"retry_interval"`
+	Headers         map[string]string `json:"headers"`
+	sessionid       string
+	httpClient      *larix.HttpClient
+	id              int    //req id
+	BaseTemplateID  string `json:"_"`
+	log             *larix.Log
 }
 
 // ZBXRequest define zabbix request body
@@ -113,6 +116,11 @@ func ZBXInit(conf *ZBXConf) (*ZBXClient, error) {
 		zc.TimeOutMs = ZBXTimeOutMS
 	}
 
+	zc.RetryIntervalMs = conf.RetryIntervalMs
+	if conf.RetryIntervalMs == 0 {
+		zc.RetryIntervalMs = ZBXRetryIntervalMS
+	}
+
 	//Headers set
 	zc.Headers = ZBXHeaders
 	if conf.Headers != "" {
@@ -143,6 +151,12 @@ func ZBXInit(conf *ZBXConf) (*ZBXClient, error) {
 	return zc, nil
 }
 
+// SetLog use l for logs of this client and its http requests, nil for default log
+func (z *ZBXClient) SetLog(l *larix.Log) {
+	z.log = l
+	z.httpClient.Log = l
+}
+
 // ZBXID to init a request id
 func (z *ZBXClient) ZBXID() int {
 	z.id++
@@ -203,9 +217,9 @@ func (z *ZBXClient) request(reqBody interface{}, retry uint32) (*ZBXResponse, er
 				"error":   err.Error(),
 				"retry":   retry,
 			}
-			larix.LogFatal(logInfo)
+			z.log.Fatal(logInfo)
 			//sleep a while and then retry
-			time.Sleep(global.ZBX_HTTP_RETRY_INTERNAL_MS * time.Millisecond)
+			time.Sleep(time.Duration(z.RetryIntervalMs) * time.Millisecond)
 			continue
 		}
 		break
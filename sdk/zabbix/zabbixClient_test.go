@@ -2,7 +2,14 @@ package zabbix
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+
+	"github.com/kstrwind/lib-go/larix"
+	"github.com/kstrwind/lib-go/larix/logtest"
 )
 
 func Test_ClientLogin(t *testing.T) {
@@ -34,3 +41,38 @@ func Test_ClientLogin(t *testing.T) {
 	fmt.Println("Zabbix logout succ:", zCase.SessionID())
 
 }
+
+func Test_ClientLoginFailedLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	zCase, err := ZBXInit(&ZBXConf{
+		IP:     host,
+		Port:   portNum,
+		URI:    "/api_jsonrpc.php",
+		User:   "Admin",
+		Passwd: "zabbix",
+		//no wait between retries
+		RetryIntervalMs: 1,
+	})
+	if err != nil {
+		t.Fatalf("zabbix init failed: %s", err)
+	}
+	logs := logtest.New()
+	defer logs.Log.Close()
+	zCase.SetLog(logs.Log)
+
+	if err := zCase.UserLogin(); err == nil {
+		t.Fatal("zabbix login should fail")
+	}
+	logs.AssertLogged(t, larix.LOG_WARN, "http request status wrong")
+	logs.AssertLogged(t, larix.LOG_FATAL, "Zabbix login failed")
+	//every retry and the login failure
+	if fatals := logs.Find(larix.LOG_FATAL, ""); len(fatals) != int(ZBXDefaultRetry)+1 {
+		t.Errorf("fatal logged %d times, want %d", len(fatals), ZBXDefaultRetry+1)
+	}
+}
@@ -6,8 +6,6 @@ import (
 	"math/rand"
 	"strconv"
 	"time"
-
-	"github.com/kstrwind/lib-go/larix"
 )
 
 // ZBXInternalUser for zabbix internal user check
@@ -43,7 +41,7 @@ func (z *ZBXClient) UserLogin() error {
 			"user":    z.User,
 			"error":   err.Error(),
 		}
-		larix.LogFatal(logInfo)
+		z.log.Fatal(logInfo)
 		return err
 	}
 
@@ -53,7 +51,7 @@ func (z *ZBXClient) UserLogin() error {
 			"message": "Zabbix login failed for sessionid not found",
 			"res":     res.Result,
 		}
-		larix.LogFatal(logInfo)
+		z.log.Fatal(logInfo)
 		return errors.New("login return no sessionid")
 	}
 
@@ -81,7 +79,7 @@ func (z *ZBXClient) UserLogout() error {
 			"user":    z.User,
 			"error":   err.Error(),
 		}
-		larix.LogFatal(logInfo)
+		z.log.Fatal(logInfo)
 		return err
 	}
 
@@ -91,7 +89,7 @@ func (z *ZBXClient) UserLogout() error {
 			"user":    z.User,
 			"res":     res.Result,
 		}
-		larix.LogFatal(logInfo)
+		z.log.Fatal(logInfo)
 		return errors.New("logout return failed")
 	}
 
@@ -108,8 +106,8 @@ func (z *ZBXClient) GenUserPasswd(uName string) string {
 	passwd.WriteString(strconv.FormatInt(time.Now().Unix(), 10))
 	// + 2位随机
 	r := rand.New(rand.NewSource(time.Now().Unix()))
-	passwd.WriteString(string(r.Intn(10)))
-	passwd.WriteString(string(r.Intn(10)))
+	passwd.WriteString(strconv.Itoa(r.Intn(10)))
+	passwd.WriteString(strconv.Itoa(r.Intn(10)))
 	return passwd.String()
 }
 